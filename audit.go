@@ -0,0 +1,64 @@
+package casbin
+
+import (
+	"sync"
+	"time"
+)
+
+// AuditLogger records the authorization decisions. Logging is
+// best-effort: Log can't fail the request, so implementations
+// should handle their own errors, e.g. by retrying or dropping
+// the entry, and shouldn't block for long as it's called inline.
+type AuditLogger interface {
+	Log(entry AuditEntry)
+}
+
+// AuditEntry is an authorization decision recorded by an AuditLogger.
+type AuditEntry struct {
+	// Roles are the roles that were enforced.
+	Roles []string
+
+	// Object is the object that was enforced.
+	Object string
+
+	// Action is the action that was enforced.
+	Action string
+
+	// Allowed is whether the request was authorized.
+	Allowed bool
+
+	// Rule is the matched policy rule if EnableExplain is set.
+	Rule []string
+
+	// RemoteIP is the IP address of the client.
+	RemoteIP string
+
+	// TraceID is the trace ID read with the TraceIDKey, if set.
+	TraceID string
+
+	// Time is when the decision was made.
+	Time time.Time
+}
+
+// MemoryAuditLogger is an AuditLogger keeping the entries in memory.
+// Meant for tests.
+type MemoryAuditLogger struct {
+	mu      sync.Mutex
+	entries []AuditEntry
+}
+
+// Log appends the entry.
+func (l *MemoryAuditLogger) Log(entry AuditEntry) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.entries = append(l.entries, entry)
+}
+
+// Entries returns a copy of the logged entries.
+func (l *MemoryAuditLogger) Entries() []AuditEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return append([]AuditEntry(nil), l.entries...)
+}
@@ -0,0 +1,144 @@
+package casbin
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuditLogger(t *testing.T) {
+	testCases := []struct {
+		name     string
+		explain  bool
+		roles    string
+		endpoint string
+		objects  string
+		entries  []AuditEntry
+	}{
+		{
+			"allowed", false, "user,admin", "/user", "",
+			[]AuditEntry{{Roles: []string{"user", "admin"}, Object: "/user", Action: "GET", Allowed: true}},
+		},
+		{
+			"allowed with explain", true, "user", "/user", "",
+			[]AuditEntry{{Roles: []string{"user"}, Object: "/user", Action: "GET", Allowed: true, Rule: []string{"user", "/user", "(GET)|(POST)|(PUT)|(DELETE)"}}},
+		},
+		{
+			"denied", false, "user", "/admin", "",
+			[]AuditEntry{{Roles: []string{"user"}, Object: "/admin", Action: "GET"}},
+		},
+		{
+			"denied objects", false, "any", "/", "/user,/admin",
+			[]AuditEntry{
+				{Roles: []string{"any"}, Object: "/user", Action: "GET"},
+				{Roles: []string{"any"}, Object: "/admin", Action: "GET"},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+
+			e.GET(tc.endpoint, func(c echo.Context) error {
+				return c.JSON(http.StatusOK, "ok")
+			})
+
+			logger := &MemoryAuditLogger{}
+			config := Config{
+				Enforcer:            enforcer,
+				EnableRolesHeader:   true,
+				EnableObjectsHeader: true,
+				EnableExplain:       tc.explain,
+				AuditLogger:         logger,
+			}
+			e.Use(CasbinWithConfig(config))
+
+			req := httptest.NewRequest(http.MethodGet, tc.endpoint, nil)
+			req.Header.Add("X-Roles", tc.roles)
+			req.Header.Add("X-Target-Objects", tc.objects)
+			req.Header.Add(echo.HeaderXRealIP, "203.0.113.1")
+			resp := httptest.NewRecorder()
+
+			before := time.Now()
+			e.ServeHTTP(resp, req)
+
+			entries := logger.Entries()
+			if assert.Len(t, entries, len(tc.entries)) {
+				for i, entry := range entries {
+					assert.Equal(t, "203.0.113.1", entry.RemoteIP)
+					assert.WithinDuration(t, before, entry.Time, time.Second)
+
+					entry.RemoteIP, entry.Time = "", time.Time{}
+					if len(entry.Rule) == 0 {
+						entry.Rule = nil
+					}
+					assert.Equal(t, tc.entries[i], entry)
+				}
+			}
+		})
+	}
+}
+
+type traceID [2]uint64
+
+func (id traceID) String() string {
+	return fmt.Sprintf("%016x%016x", id[0], id[1])
+}
+
+func TestAuditLogger_TraceIDKey(t *testing.T) {
+	testCases := []struct {
+		name     string
+		key      string
+		value    interface{}
+		roles    string
+		endpoint string
+		traceID  string
+	}{
+		{"denied", "trace_id", "4bf92f3577b34da6", "user", "/admin", "4bf92f3577b34da6"},
+		{"allowed", "trace_id", "4bf92f3577b34da6", "admin", "/admin", "4bf92f3577b34da6"},
+		{"stringer", "trace_id", traceID{1, 2}, "user", "/admin", "00000000000000010000000000000002"},
+		{"not set", "trace_id", nil, "user", "/admin", ""},
+		{"no key", "", "4bf92f3577b34da6", "user", "/admin", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+
+			e.GET(tc.endpoint, func(c echo.Context) error {
+				return c.JSON(http.StatusOK, "ok")
+			})
+
+			e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+				return func(c echo.Context) error {
+					if tc.value != nil {
+						c.Set("trace_id", tc.value)
+					}
+					return next(c)
+				}
+			})
+
+			logger := &MemoryAuditLogger{}
+			config := Config{
+				Enforcer:          enforcer,
+				EnableRolesHeader: true,
+				AuditLogger:       logger,
+				TraceIDKey:        tc.key,
+			}
+			e.Use(CasbinWithConfig(config))
+
+			serve(e, tc.roles, tc.endpoint)
+
+			entries := logger.Entries()
+			if assert.Len(t, entries, 1) {
+				assert.Equal(t, tc.traceID, entries[0].TraceID)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package casbin
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// BumpGeneration atomically increments the policy generation, to be
+// called after changing the policies of an enforcer whose middleware
+// has its Config.PolicyGeneration set to gen.
+func BumpGeneration(gen *uint64) {
+	atomic.AddUint64(gen, 1)
+}
+
+// decisionCache is an LRU cache of enforcement results
+// with a per-entry expiry.
+type decisionCache struct {
+	mu    sync.Mutex
+	size  int
+	ttl   time.Duration
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+type cacheEntry struct {
+	key     string
+	pass    bool
+	rule    []string
+	expires time.Time
+}
+
+func newDecisionCache(size int, ttl time.Duration) *decisionCache {
+	return &decisionCache{
+		size:  size,
+		ttl:   ttl,
+		ll:    list.New(),
+		items: make(map[string]*list.Element, size),
+	}
+}
+
+// get returns the cached result for key if it hasn't expired.
+func (dc *decisionCache) get(key string) (bool, []string, bool) {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+
+	el, ok := dc.items[key]
+	if !ok {
+		return false, nil, false
+	}
+
+	entry := el.Value.(*cacheEntry)
+	if time.Now().After(entry.expires) {
+		dc.ll.Remove(el)
+		delete(dc.items, key)
+		return false, nil, false
+	}
+
+	dc.ll.MoveToFront(el)
+	return entry.pass, entry.rule, true
+}
+
+// set caches the result for key, evicting the least
+// recently used entry if the cache is full.
+func (dc *decisionCache) set(key string, pass bool, rule []string) {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+
+	expires := time.Now().Add(dc.ttl)
+	if el, ok := dc.items[key]; ok {
+		entry := el.Value.(*cacheEntry)
+		entry.pass, entry.rule, entry.expires = pass, rule, expires
+		dc.ll.MoveToFront(el)
+		return
+	}
+
+	dc.items[key] = dc.ll.PushFront(&cacheEntry{key: key, pass: pass, rule: rule, expires: expires})
+	if dc.ll.Len() > dc.size {
+		el := dc.ll.Back()
+		dc.ll.Remove(el)
+		delete(dc.items, el.Value.(*cacheEntry).key)
+	}
+}
+
+// clear removes every entry from the cache.
+func (dc *decisionCache) clear() {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+
+	dc.ll.Init()
+	dc.items = make(map[string]*list.Element, dc.size)
+}
+
+// cacheKey returns the key for the request values, or false
+// if they can't be used as a key.
+func cacheKey(rvals []interface{}) (string, bool) {
+	parts := make([]string, 0, len(rvals))
+	for _, rval := range rvals {
+		s, ok := rval.(string)
+		if !ok {
+			return "", false
+		}
+		parts = append(parts, s)
+	}
+
+	return strings.Join(parts, "\x00"), true
+}
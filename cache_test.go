@@ -0,0 +1,130 @@
+package casbin
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/casbin/casbin/v2"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecisionCache(t *testing.T) {
+	dc := newDecisionCache(2, time.Minute)
+
+	dc.set("a", true, []string{"a"})
+	dc.set("b", false, nil)
+
+	pass, rule, found := dc.get("a")
+	assert.True(t, found)
+	assert.True(t, pass)
+	assert.Equal(t, []string{"a"}, rule)
+
+	// "b" is now the least recently used
+	dc.set("c", true, nil)
+
+	_, _, found = dc.get("b")
+	assert.False(t, found)
+
+	_, _, found = dc.get("a")
+	assert.True(t, found)
+
+	_, _, found = dc.get("c")
+	assert.True(t, found)
+
+	dc.set("a", false, nil)
+	pass, _, found = dc.get("a")
+	assert.True(t, found)
+	assert.False(t, pass)
+}
+
+func TestDecisionCache_Expiry(t *testing.T) {
+	dc := newDecisionCache(2, 10*time.Millisecond)
+
+	dc.set("a", true, nil)
+
+	_, _, found := dc.get("a")
+	assert.True(t, found)
+
+	time.Sleep(20 * time.Millisecond)
+
+	_, _, found = dc.get("a")
+	assert.False(t, found)
+	assert.Equal(t, 0, dc.ll.Len())
+}
+
+func TestCacheKey(t *testing.T) {
+	key, ok := cacheKey([]interface{}{"user", "/user", "GET"})
+	assert.True(t, ok)
+	assert.Equal(t, "user\x00/user\x00GET", key)
+
+	_, ok = cacheKey([]interface{}{struct{}{}, "/user", "GET"})
+	assert.False(t, ok)
+}
+
+func TestDecisionCache_Clear(t *testing.T) {
+	dc := newDecisionCache(2, time.Minute)
+
+	dc.set("a", true, nil)
+	dc.clear()
+
+	_, _, found := dc.get("a")
+	assert.False(t, found)
+
+	dc.set("a", true, nil)
+	_, _, found = dc.get("a")
+	assert.True(t, found)
+}
+
+func TestBumpGeneration(t *testing.T) {
+	ge, err := casbin.NewSyncedEnforcer("./fixtures/model.conf", "./fixtures/policy.csv")
+	assert.NoError(t, err)
+
+	e := echo.New()
+
+	e.GET("/admin", func(c echo.Context) error {
+		return c.JSON(http.StatusOK, "ok")
+	})
+
+	var gen uint64
+	config := Config{
+		Enforcer:          ge,
+		EnableRolesHeader: true,
+		CacheTTL:          time.Hour,
+		PolicyGeneration:  &gen,
+	}
+	e.Use(CasbinWithConfig(config))
+
+	assert.Equal(t, http.StatusForbidden, serve(e, "user", "/admin"))
+
+	_, err = ge.AddPolicy("user", "/admin", "GET")
+	assert.NoError(t, err)
+
+	assert.Equal(t, http.StatusForbidden, serve(e, "user", "/admin"), "cached")
+
+	BumpGeneration(&gen)
+	assert.Equal(t, http.StatusOK, serve(e, "user", "/admin"))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 25; j++ {
+				BumpGeneration(&gen)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 25; j++ {
+				assert.Equal(t, http.StatusOK, serve(e, "user", "/admin"))
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, uint64(101), atomic.LoadUint64(&gen))
+}
@@ -1,94 +1,825 @@
 package casbin
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
 	"net/http"
+	"reflect"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/casbin/casbin/v2"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 )
 
+// GroupProvider looks up the roles or groups of a subject.
+type GroupProvider interface {
+	GroupsFor(ctx context.Context, subject string) ([]string, error)
+}
+
+// MetricsCollector collects the authorization outcomes.
+// See the prometheus subpackage for a Prometheus implementation.
+type MetricsCollector interface {
+	// IncAllowed is called with the role that was authorized.
+	IncAllowed(role string, obj string, act string)
+
+	// IncDenied is called with the roles that were denied.
+	IncDenied(roles []string, obj string, act string)
+}
+
+// Endpoint is a route of PublicEndpoints.
+type Endpoint struct {
+	// Method is the request method, matched case-insensitively.
+	Method string
+
+	// Path is the route path, as returned by c.Path().
+	Path string
+}
+
+// EmptyRolesBehavior defines what happens to the
+// requests for which no roles were found.
+type EmptyRolesBehavior int
+
+const (
+	// EmptyRolesUseDefaultRole enforces the DefaultRole or DefaultRoles.
+	EmptyRolesUseDefaultRole EmptyRolesBehavior = iota
+
+	// EmptyRolesDeny denies the requests.
+	EmptyRolesDeny
+
+	// EmptyRolesAllow allows the requests without enforcing.
+	EmptyRolesAllow
+)
+
 type Config struct {
 	// Skipper defines a function to skip middleware.
 	Skipper middleware.Skipper
 
+	// SkipOptions enables skipping the middleware for OPTIONS
+	// requests, e.g. CORS preflight requests. Either the Skipper
+	// or SkipOptions can skip the middleware.
+	// Optional. Defaults to false.
+	SkipOptions bool
+
+	// EnforcedMethods defines the request methods the middleware
+	// enforces, case-insensitively. Requests with other methods are
+	// skipped. Every method is enforced if it's empty.
+	// Optional.
+	EnforcedMethods []string
+
+	// SkipUnmatchedRoutes enables skipping the middleware for requests
+	// that didn't match a route, so Echo can return its 404 instead
+	// of the middleware denying them.
+	// Optional. Defaults to false.
+	SkipUnmatchedRoutes bool
+
+	// PublicEndpoints defines the routes, by method and path, that
+	// are allowed without enforcing, e.g. {"GET", "/openapi.json"}.
+	// Optional.
+	PublicEndpoints []Endpoint
+
 	// Enforce defines the enforcer used for
 	// authorization enforcement and policy management.
-	// Required.
-	Enforcer *casbin.Enforcer
+	// Accepts any casbin.IEnforcer, e.g. a *casbin.SyncedEnforcer.
+	// Required, unless EnforcerFunc is set.
+	Enforcer casbin.IEnforcer
+
+	// EnforcerFunc defines the function that will select the enforcer
+	// for each request, e.g. per tenant. Takes precedence over Enforcer.
+	// Returning a nil enforcer results in a 500.
+	// Optional.
+	EnforcerFunc func(echo.Context) (casbin.IEnforcer, error)
 
 	// ContextKey defines the key that will be used to
 	// read the roles on the echo.Context for enforcing.
+	// The value can be a []string, a []interface{} or a slice of
+	// a string type, see RolesTypeFunc for other types.
 	// Optional. Defaults to "roles".
 	ContextKey string
 
-	// DefaultRoles defines
+	// ContextKeys defines the keys that will be used to read the
+	// roles on the echo.Context instead of the ContextKey. The roles
+	// found under every key are merged, in the order of the keys.
+	// Optional.
+	ContextKeys []string
+
+	// RolesTypeFunc defines the function that will convert the value
+	// read on the echo.Context with the ContextKey to roles when it isn't
+	// a []string, a []interface{} or a slice of a string type, e.g. a
+	// struct. Values of other types result in no roles if it isn't set.
+	// Optional.
+	RolesTypeFunc func(interface{}) ([]string, error)
+
+	// DefaultRole defines the role that will be enforced
+	// if no roles were found. Ignored if DefaultRoles is set.
 	// Optional. Defaults to "any".
 	DefaultRole string
 
+	// DefaultRoles defines the roles that will be enforced
+	// if no roles were found, instead of the DefaultRole.
+	// Optional.
+	DefaultRoles []string
+
+	// DenyOnEmptyRoles denies the requests for which no roles were
+	// found instead of falling back to the DefaultRole or DefaultRoles.
+	// Shorthand for setting EmptyRolesBehavior to EmptyRolesDeny.
+	// Optional. Defaults to false.
+	DenyOnEmptyRoles bool
+
+	// EmptyRolesBehavior defines what happens to the requests for
+	// which no roles were found, whether from the RolesFunc,
+	// GroupProvider, ContextKey or RolesHeader.
+	// Optional. Defaults to EmptyRolesUseDefaultRole.
+	EmptyRolesBehavior EmptyRolesBehavior
+
 	// EnableRolesHeader enables the RolesHeader.
 	// Optional. Defaults to false.
 	EnableRolesHeader bool
 
 	// RolesHeader defines the header that will be used to
 	// read in the roles if EnableRolesHeader is set to true.
-	// Roles should be separated by commas. E.g. "role1,role2".
-	// Optional. Defaults to false.
+	// Roles should be separated by the RolesHeaderDelimiter. E.g. "role1,role2".
+	// Set it to "Grpc-Metadata-Roles" to read the roles from
+	// metadata forwarded by grpc-gateway.
+	// Optional. Defaults to "X-Roles".
 	RolesHeader string
 
+	// RolesHeaderDelimiter defines the delimiter that will be
+	// used to split the RolesHeader. It isn't used if the
+	// RolesHeaderFunc or RolesHeaderFuncCtx is set.
+	// Optional. Defaults to ",".
+	RolesHeaderDelimiter string
+
 	// RolesHeaderFunc defines the function that will validate that
 	// a client is allowed to the use roles they passed via the RolesHeader.
 	// The RolesHeader value will be passed unmodified, so you will need
-	// to parse it in this function yourself. The DefaultRole will be passed
+	// to parse it in this function yourself. The DefaultRole, or the
+	// DefaultRoles joined by the RolesHeaderDelimiter, will be passed
 	// if the RolesHeader is empty. The roles that you want to have
 	// enforced will need to be returned in a slice: []string{"role1, "role2"}.
 	// Optional.
 	RolesHeaderFunc func(string) ([]string, error)
 
+	// RolesHeaderFuncCtx is the RolesHeaderFunc with the echo.Context,
+	// e.g. to validate the roles against the authenticated subject.
+	// Takes precedence over RolesHeaderFunc if they're both defined.
+	// Optional.
+	RolesHeaderFuncCtx func(c echo.Context, header string) ([]string, error)
+
 	// RolesFunc defines the function that will retrieve the roles
 	// to be passed to the Enforcer.
 	// Takes precedence over ContextKey and RolesHeader if they're defined.
 	// Optional.
 	RolesFunc func(echo.Context) ([]string, error)
 
+	// SubjectFunc defines the function that will produce the subject
+	// passed to the Enforcer, e.g. a struct for ABAC matchers such as
+	// "r.sub.Department == p.sub". The subject is enforced once instead
+	// of the roles, which aren't resolved, and isn't passed to the
+	// BeforeEnforce. A string subject goes through the NormalizeSubject.
+	// Mutually exclusive with RolesFunc.
+	// Optional.
+	SubjectFunc func(echo.Context) (interface{}, error)
+
+	// SubjectFromIP enables using the client IP, as returned by
+	// c.RealIP(), as the subject, e.g. for models using ipMatch.
+	// It's a SubjectFunc returning the IP and is ignored if
+	// SubjectFunc is set. Without an Echo#IPExtractor, RealIP trusts
+	// the X-Forwarded-For and X-Real-IP headers sent by any client,
+	// so set one, e.g. echo.ExtractIPDirect() or
+	// echo.ExtractIPFromXFFHeader() with the trusted proxies.
+	// Optional. Defaults to false.
+	SubjectFromIP bool
+
+	// GroupProvider defines the provider that will be used to look up
+	// the roles of the subject read on the echo.Context with the
+	// SubjectContextKey, instead of relying on roles supplied by the client.
+	// Takes precedence over ContextKey and RolesHeader if they're defined.
+	// Optional.
+	GroupProvider GroupProvider
+
+	// MergeRoleSources merges the roles read from the RolesHeader with
+	// the roles from the RolesFunc, GroupProvider or ContextKey instead
+	// of only reading the RolesHeader when no other roles were found.
+	// Duplicate roles are enforced once. Requires EnableRolesHeader.
+	// Optional. Defaults to false.
+	MergeRoleSources bool
+
+	// SubjectContextKey defines the key that will be used to read
+	// the subject on the echo.Context when using the GroupProvider.
+	// E.g. the subject of the token set by an authentication middleware.
+	// Optional. Defaults to "subject".
+	SubjectContextKey string
+
+	// MatchAllRoles enables requiring every role to be authorized,
+	// instead of any of them, for the request to be authorized.
+	// Enforcement stops at the first role that isn't. The SuccessFunc
+	// then runs once per role, after all of them were authorized.
+	// Optional. Defaults to false.
+	MatchAllRoles bool
+
+	// SuperRole defines the role that is authorized to perform
+	// every action on every object without calling the Enforcer, e.g.
+	// a break-glass "superadmin", including in the PermittedActions and
+	// Capabilities. It's compared case-sensitively with the roles after
+	// the NormalizeSubject, and takes precedence over MatchAllRoles.
+	// Ignored if SubjectFunc is set.
+	// Optional.
+	SuperRole string
+
+	// NormalizeSubject defines the function that will be used to
+	// normalize the subjects before they're passed to the Enforcer.
+	// E.g. strings.ToLower when subjects are emails stored lowercased
+	// in the policies. Applies to subjects from any source, including
+	// the subject passed to the GroupProvider.
+	// Optional.
+	NormalizeSubject func(string) string
+
+	// DomainFunc defines the function that will retrieve the domain,
+	// or tenant, of the request for models using RBAC with domains,
+	// e.g. a request definition of "r = sub, dom, obj, act".
+	// When defined, the Enforcer is called with the role, domain,
+	// object and action instead of the role, object and action.
+	// Optional.
+	DomainFunc func(echo.Context) (string, error)
+
+	// SubjectFormat defines the template of the subject built from the
+	// "{domain}" and "{role}" tokens, e.g. "{domain}:{role}", to scope
+	// the roles to the domain returned by the DomainFunc with models
+	// without domains. When defined, the Enforcer is called with the
+	// formatted subject, object and action instead of the role, domain,
+	// object and action. Requires a DomainFunc.
+	// Optional.
+	SubjectFormat string
+
+	// MatcherFunc defines the function that will return the matcher
+	// used for the request, e.g. a relaxed matcher for some routes,
+	// with EnforceWithMatcher instead of Enforce. Returning an empty
+	// string uses the matcher of the model.
+	// Optional.
+	MatcherFunc func(echo.Context) string
+
+	// UseRequestURI enables using the path of the request URI,
+	// e.g. "/users/42", as the object instead of the route path,
+	// e.g. "/users/:id". Useful with Casbin's path matching functions.
+	// The query string isn't included.
+	// Optional. Defaults to false.
+	UseRequestURI bool
+
+	// ObjectTemplate defines the template that will be rendered as
+	// the object by replacing its ":param" tokens with the values of
+	// the route params, e.g. "/users/:id" becomes "/users/42".
+	// Tokens of params that are missing or empty are left as is.
+	// Takes precedence over UseRequestURI.
+	// Optional.
+	ObjectTemplate string
+
+	// ObjectFunc defines the function that will retrieve the object
+	// to be passed to the Enforcer, e.g. the concrete resource
+	// "/users/42" rather than the route "/users/:id".
+	// Takes precedence over ObjectTemplate and UseRequestURI.
+	// Optional. Defaults to the route path from echo.Context.Path().
+	ObjectFunc func(echo.Context) (string, error)
+
+	// TrimPrefix defines the path prefix that will be stripped from
+	// the object, e.g. "/api/v1" added by a gateway, so the policies
+	// can be written against the bare paths. It's only stripped when
+	// followed by a "/" or the end of the object and is applied after
+	// the ObjectFunc. Set it to the prefix of the echo.Group the
+	// middleware is used on to write the policies against the paths
+	// relative to the group, as c.Path() includes the group prefix.
+	// Optional.
+	TrimPrefix string
+
+	// TrimTrailingSlash enables stripping a single trailing "/" from
+	// the object, after the TrimPrefix, so "/users/" and "/users" match
+	// the same policies. The root "/" is left as is.
+	// Optional. Defaults to false.
+	TrimTrailingSlash bool
+
+	// NormalizeMethod enables uppercasing the request method
+	// before using it as the action.
+	// Optional. Defaults to false.
+	NormalizeMethod bool
+
+	// ActionFunc defines the function that will retrieve the action
+	// to be passed to the Enforcer, e.g. semantic actions like
+	// "read" or "write" rather than HTTP methods.
+	// Takes precedence over NormalizeMethod.
+	// Optional. Defaults to the request method.
+	ActionFunc func(echo.Context) (string, error)
+
+	// BeforeEnforce defines the function that will be called for
+	// every role right before enforcing, once the object and action
+	// are resolved, to rewrite the subject, object and action passed
+	// to the Enforcer. A rewritten object is normalized with the
+	// NormalizeObject. The rewritten values are also passed to the
+	// SuccessFunc and FailureFunc, but the AuthorizedRoleKey and
+	// AuthorizedRoleHeader keep the role. Returning an error aborts the request.
+	// Optional.
+	BeforeEnforce func(c echo.Context, role string, obj string, act string) (string, string, string, error)
+
+	// NormalizeObject defines the function that will be used to
+	// normalize the objects before they're passed to the Enforcer.
+	// E.g. trimming, percent-decoding or lowercasing. Runs last,
+	// regardless of how the objects were derived, including the
+	// objects rewritten by the BeforeEnforce.
+	// Optional.
+	NormalizeObject func(string) string
+
+	// EnableObjectsHeader enables the ObjectsHeader.
+	// Optional. Defaults to false.
+	EnableObjectsHeader bool
+
+	// ObjectsHeader defines the header that will be used to read
+	// the target objects of the request if EnableObjectsHeader is set to true.
+	// The action is enforced against every listed object as well as the
+	// request's object, and the request is only authorized if all of them pass.
+	// The SuccessFunc, OnAllow and MetricsCollector only run for the
+	// request's object, once all of them passed.
+	// Objects should be separated by the ObjectsHeaderDelimiter. E.g. "/a,/b".
+	// Empty objects are skipped.
+	// Optional. Defaults to "X-Target-Objects".
+	ObjectsHeader string
+
+	// ObjectsHeaderDelimiter defines the delimiter that will be
+	// used to split the objects read from the ObjectsHeader.
+	// Optional. Defaults to ",".
+	ObjectsHeaderDelimiter string
+
+	// PermittedActions defines the actions that will be evaluated
+	// for the object across all roles once the request is authorized.
+	// The result is a map[string]bool of each action to whether any
+	// of the roles is permitted to perform it, and is set on the
+	// echo.Context under PermittedActionsKey.
+	// Optional.
+	PermittedActions []string
+
+	// PermittedActionsKey defines the key that will be used to
+	// set the permitted actions on the echo.Context.
+	// Optional. Defaults to "permitted_actions".
+	PermittedActionsKey string
+
+	// EnableDecisionTrailer enables the DecisionTrailer.
+	// Meant for debugging, trailers are only supported by
+	// some clients and proxies and are not sent over HTTP/1.0.
+	// Optional. Defaults to false.
+	EnableDecisionTrailer bool
+
+	// DecisionTrailer defines the HTTP trailer that will be set to
+	// "allowed" once the handler of an authorized request completes
+	// if EnableDecisionTrailer is set to true.
+	// Optional. Defaults to "X-Authorization-Decision".
+	DecisionTrailer string
+
+	// ReadOnlyMode enables the read-only mode, e.g. during maintenance.
+	// Mutating methods are denied with the MaintenanceMessage and a 503
+	// before enforcement, overriding the policies. Safe methods
+	// (GET, HEAD and OPTIONS, in any case) are still enforced as usual.
+	// Optional. Defaults to false.
+	ReadOnlyMode bool
+
+	// ReadOnlyModeFunc defines the function that will report whether
+	// the read-only mode is enabled, checked on every request, so it
+	// can be toggled at runtime, e.g. with an atomic.Bool's Load method.
+	// Takes precedence over ReadOnlyMode.
+	// Optional.
+	ReadOnlyModeFunc func() bool
+
+	// MaintenanceMessage defines the message that will be
+	// returned when a request is denied by the ReadOnlyMode.
+	// Optional. Defaults to "This resource is in read-only mode for maintenance".
+	MaintenanceMessage string
+
+	// RetryAfter defines the duration that will be sent in the
+	// Retry-After header when a request is denied by the ReadOnlyMode,
+	// rounded up to the second.
+	// Optional. The header isn't sent if not set.
+	RetryAfter time.Duration
+
+	// Capabilities defines the related objects and their actions that
+	// will be evaluated across all roles once the request is authorized.
+	// E.g. map[string][]string{"/user": {"GET", "POST"}, "/admin": {"GET"}}.
+	// The result is a map[string]map[string]bool of each object to whether
+	// any of the roles is permitted to perform each of its actions, and is
+	// set on the echo.Context under CapabilitiesKey. Every role, object and
+	// action combination is enforced, so keep the matrix small.
+	// Optional.
+	Capabilities map[string][]string
+
+	// CapabilitiesKey defines the key that will be used to
+	// set the capabilities on the echo.Context.
+	// Optional. Defaults to "capabilities".
+	CapabilitiesKey string
+
+	// EnableCapabilitiesHeader enables the CapabilitiesHeader.
+	// Optional. Defaults to false.
+	EnableCapabilitiesHeader bool
+
+	// CapabilitiesHeader defines the response header that will be set
+	// to the JSON encoded capabilities if EnableCapabilitiesHeader is set to true.
+	// Optional. Defaults to "X-Capabilities".
+	CapabilitiesHeader string
+
 	// ForbiddenMessage defines the message that will be
-	// returned when authorization fails.
+	// returned when authorization fails. It's returned as JSON,
+	// or as plain text if the Accept header prefers text/plain,
+	// by its quality values. The *echo.HTTPError is returned in
+	// both cases, the plain text response is written beforehand.
 	// Optional. Defaults to "Access to this resource has been restricted".
 	ForbiddenMessage string
 
+	// ForbiddenResponseField defines the field of the JSON error that
+	// will be set to the ForbiddenMessage when authorization fails,
+	// e.g. "error" to return {"error": "..."}.
+	// Optional. Defaults to "message".
+	ForbiddenResponseField string
+
+	// ForbiddenStatusCode defines the status code that will be
+	// returned when authorization fails.
+	// Optional. Defaults to 403.
+	ForbiddenStatusCode int
+
+	// IncludeDetailsInError enables adding the object and action
+	// that were denied to the JSON error, e.g.
+	// {"message": "...", "object": "/admin", "action": "GET"}.
+	// The roles aren't included to avoid disclosing them.
+	// Optional. Defaults to false.
+	IncludeDetailsInError bool
+
+	// Realm defines the realm of the WWW-Authenticate header,
+	// e.g. `Bearer realm="Restricted"`, that is set when the
+	// ForbiddenStatusCode is 401. It isn't set by the ErrorHandler.
+	// Optional. Defaults to "Restricted".
+	Realm string
+
+	// ResolvedRolesKey defines the key that will be used to set the
+	// roles resolved for the request on the echo.Context before they're
+	// enforced, so they're available whether the request is authorized
+	// or not, e.g. to the ErrorHandler.
+	// Optional. Defaults to "resolved_roles".
+	ResolvedRolesKey string
+
+	// AuthorizedRoleKey defines the key that will be used to set
+	// the role that authorized the request on the echo.Context.
+	// The roles are set as a []string if MatchAllRoles is set.
+	// Optional. Defaults to "authorized_role".
+	AuthorizedRoleKey string
+
+	// EnableAuthorizedRoleHeader enables the AuthorizedRoleHeader.
+	// Optional. Defaults to false.
+	EnableAuthorizedRoleHeader bool
+
+	// AuthorizedRoleHeader defines the response header that will be
+	// set to the role that authorized the request if
+	// EnableAuthorizedRoleHeader is set to true. The roles are
+	// separated by commas if MatchAllRoles is set.
+	// Optional. Defaults to "X-Authorized-Role".
+	AuthorizedRoleHeader string
+
+	// EnableExplain enables explaining the decisions with the
+	// matched policy rule, using EnforceEx instead of Enforce.
+	// The rule that authorized the request is set on the
+	// echo.Context under MatchedPolicyKey.
+	// Optional. Defaults to false.
+	EnableExplain bool
+
+	// MatchedPolicyKey defines the key that will be used to set the
+	// matched policy rule on the echo.Context if EnableExplain is set to true.
+	// Optional. Defaults to "casbin_matched_policy".
+	MatchedPolicyKey string
+
+	// ExplainFunc defines the function that will run after every
+	// enforcement with the decision, the enforced role and the matched
+	// policy rule, if any, if EnableExplain is set to true.
+	// Optional.
+	ExplainFunc func(allowed bool, role string, rule []string, obj string, act string)
+
+	// EnforceTimeout defines the maximum duration of the enforcement,
+	// e.g. when the policies are backed by a remote store. A 503 is
+	// returned if it expires or the request context is canceled.
+	// The enforcement stops at the next role once it expires. The
+	// BeforeEnforce then runs for every role upfront and the other
+	// hooks once the enforcement completes, so none run after the timeout.
+	// Optional. Defaults to no timeout.
+	EnforceTimeout time.Duration
+
+	// PolicyFile defines the path of the policy file of the Enforcer
+	// that will be watched for changes if WatchInterval is set.
+	// The policies are reloaded, and the cache invalidated, when its
+	// modification time changes. The ReloadLock is set to &ReloadLock
+	// if it's nil and the Enforcer isn't synchronized, e.g. a *casbin.Enforcer.
+	// The watcher runs until the WatchContext is done, so every
+	// middleware created with a PolicyFile should have one.
+	// Optional.
+	PolicyFile string
+
+	// ReloadLock defines the lock whose read lock will be taken while
+	// enforcing, so the policies can be reloaded under its write lock.
+	// Set it to &ReloadLock to reload a *casbin.Enforcer with
+	// ReloadSafely, which the PolicyFile watcher also uses.
+	// Not needed with a *casbin.SyncedEnforcer.
+	// Optional.
+	ReloadLock *sync.RWMutex
+
+	// WatchInterval defines how often the PolicyFile is checked for changes.
+	// Optional. Defaults to not watching.
+	WatchInterval time.Duration
+
+	// WatchContext defines the context that stops the PolicyFile
+	// watcher once it's done, e.g. on shutdown, or when the middleware
+	// is recreated. Without it, the watcher runs for the lifetime of
+	// the process.
+	// Optional.
+	WatchContext context.Context
+
+	// MetricsCollector defines the collector that will be
+	// notified of every authorization outcome.
+	// Optional.
+	MetricsCollector MetricsCollector
+
+	// AuditLogger defines the logger that every decision will be
+	// recorded to, once per denied object when using the ObjectsHeader.
+	// See MemoryAuditLogger for an in-memory implementation.
+	// Optional.
+	AuditLogger AuditLogger
+
+	// TraceIDKey defines the key that will be used to read the trace,
+	// or correlation, ID on the echo.Context, e.g. set by a tracing
+	// middleware, to add it to the AuditEntry. Values that aren't
+	// strings are formatted with fmt.Sprint.
+	// Optional.
+	TraceIDKey string
+
+	// CacheTTL enables caching the enforcement results by their
+	// role, domain, object and action for the defined duration.
+	// The cache is invalidated when the PolicyFile is reloaded, but
+	// not when the policies change otherwise, so the PolicyGeneration
+	// must be bumped, or the middleware recreated, after e.g. calling
+	// LoadPolicy yourself. The roles looked up with the GroupProvider
+	// are also cached by subject for the defined duration, separately.
+	// The enforcement results aren't cached if EnforcerFunc is set.
+	// Optional. Defaults to no caching.
+	CacheTTL time.Duration
+
+	// CacheSize defines the maximum number of enforcement results,
+	// and of subjects of the GroupProvider, kept in the caches if
+	// CacheTTL is set. The least recently used are evicted first.
+	// Optional. Defaults to 1000.
+	CacheSize int
+
+	// PolicyGeneration defines the generation of the policies, which is
+	// part of the cache keys so the cached results are invalidated when
+	// it changes. Increment it with BumpGeneration after changing the
+	// policies, e.g. with AddPolicy or LoadPolicy.
+	// Optional.
+	PolicyGeneration *uint64
+
+	// UseBatchEnforce enables enforcing all the roles in a single
+	// BatchEnforce call instead of one Enforce call per role. The
+	// BeforeEnforce then runs for every role upfront and the cache
+	// isn't used. Falls back to one call per role if BatchEnforce
+	// fails. Ignored if EnableExplain is set. The casbin enforcers
+	// evaluate the batch one request at a time, so it's mostly
+	// useful with enforcers that batch more efficiently.
+	// Optional. Defaults to false.
+	UseBatchEnforce bool
+
+	// OnDecision defines the function that will run on every
+	// request once enforcement completes, whether it was authorized
+	// or not, with the first denied object if it wasn't. It runs
+	// after the SuccessFunc, but before the FailureFunc and
+	// before the error is returned.
+	// Optional.
+	OnDecision func(c echo.Context, allowed bool, roles []string, obj string, act string)
+
+	// FailOpen authorizes a role when the Enforcer returns an error
+	// for it instead of returning the error. With MatchAllRoles, the
+	// other roles still need to be authorized. Only use it for
+	// non-critical endpoints.
+	// Optional. Defaults to false.
+	FailOpen bool
+
+	// OnEnforceError defines the function that will run with the
+	// error returned by the Enforcer when FailOpen is set, and with
+	// the error returned by the GroupProvider, with the subject as the
+	// role and the route path and method, before it's returned.
+	// Optional.
+	OnEnforceError func(c echo.Context, role string, obj string, act string, err error)
+
+	// ErrorHandler defines the function that will be called
+	// instead of returning the default error when authorization fails,
+	// after the FailureFunc. Its return value is returned by the middleware,
+	// so it can write its own response and return nil.
+	// Optional.
+	ErrorHandler func(c echo.Context, roles []string, obj string, act string) error
+
 	// SuccessFunc defines the function that will run
 	// when authorization succeeds.
 	// Optional.
 	SuccessFunc func(string, string, string)
 
 	// FailureFunc defines the function that will run
-	// when authorization fails.
+	// when authorization fails. It runs once per object
+	// that failed when using the ObjectsHeader.
 	// Optional.
 	FailureFunc func([]string, string, string)
+
+	// OnAllow defines the function that will run when authorization
+	// succeeds, with the role that was authorized and all the roles.
+	// It runs right after the SuccessFunc, as many times.
+	// Optional.
+	OnAllow func(c echo.Context, matchedRole string, roles []string, obj string, act string)
+
+	// OnDeny defines the function that will run when authorization
+	// fails. It runs right after the FailureFunc, as many times.
+	// Optional.
+	OnDeny func(c echo.Context, roles []string, obj string, act string)
+
+	// AfterAllow defines the function that will run once authorization
+	// succeeds, before the next handler, once per authorized role: the
+	// matched role, every role with MatchAllRoles, or the subject with
+	// SubjectFunc if it's a string, otherwise it doesn't run.
+	// Unlike the SuccessFunc, it runs after enforcement, so it can
+	// modify the policies of the enforcer, e.g. to grant a role on first
+	// access. It runs without any lock, wrap the changes in UpdateSafely
+	// when the enforcer isn't synchronized, so only the requests that
+	// modify the policies wait for the enforcements in progress.
+	// Cached decisions aren't invalidated, use BumpGeneration for that.
+	// Optional.
+	AfterAllow func(c echo.Context, enforcer casbin.IEnforcer, role string, obj string, act string) error
+
+	// FailOnAfterAllowError returns an internal server error wrapping the
+	// error returned by the AfterAllow instead of ignoring it.
+	// Optional. Defaults to false.
+	FailOnAfterAllowError bool
 }
 
+// DefaultConfig is the default Casbin middleware config.
+// Prefer NewDefaultConfig to get a copy that can be modified.
 var DefaultConfig = Config{
-	Skipper:          middleware.DefaultSkipper,
-	ContextKey:       "roles",
-	DefaultRole:      "any",
-	RolesHeader:      "X-Roles",
-	ForbiddenMessage: "Access to this resource has been restricted",
+	Skipper:                middleware.DefaultSkipper,
+	ContextKey:             "roles",
+	DefaultRole:            "any",
+	SubjectContextKey:      "subject",
+	RolesHeader:            "X-Roles",
+	RolesHeaderDelimiter:   ",",
+	ObjectsHeader:          "X-Target-Objects",
+	ObjectsHeaderDelimiter: ",",
+	PermittedActionsKey:    "permitted_actions",
+	CapabilitiesKey:        "capabilities",
+	CapabilitiesHeader:     "X-Capabilities",
+	DecisionTrailer:        "X-Authorization-Decision",
+	ResolvedRolesKey:       "resolved_roles",
+	AuthorizedRoleKey:      "authorized_role",
+	AuthorizedRoleHeader:   "X-Authorized-Role",
+	MatchedPolicyKey:       "casbin_matched_policy",
+	MaintenanceMessage:     "This resource is in read-only mode for maintenance",
+	ForbiddenMessage:       "Access to this resource has been restricted",
+	ForbiddenResponseField: "message",
+	ForbiddenStatusCode:    http.StatusForbidden,
+	Realm:                  "Restricted",
+	CacheSize:              1000,
 }
 
-func Casbin(ce *casbin.Enforcer) echo.MiddlewareFunc {
+// NewDefaultConfig returns a copy of the DefaultConfig whose slices
+// and maps can be modified without affecting the DefaultConfig.
+func NewDefaultConfig() Config {
 	c := DefaultConfig
+	c.EnforcedMethods = append([]string(nil), c.EnforcedMethods...)
+	c.PublicEndpoints = append([]Endpoint(nil), c.PublicEndpoints...)
+	c.ContextKeys = append([]string(nil), c.ContextKeys...)
+	c.DefaultRoles = append([]string(nil), c.DefaultRoles...)
+	c.PermittedActions = append([]string(nil), c.PermittedActions...)
+	if c.Capabilities != nil {
+		caps := make(map[string][]string, len(c.Capabilities))
+		for obj, acts := range c.Capabilities {
+			caps[obj] = append([]string(nil), acts...)
+		}
+		c.Capabilities = caps
+	}
+
+	return c
+}
+
+// Validate returns an error describing the first misconfiguration
+// of the Config, e.g. a missing enforcer. CasbinWithConfig panics
+// with it, so it can be used to check a Config at startup.
+func (c Config) Validate() error {
+	if isNil(c.Enforcer) && c.EnforcerFunc == nil {
+		return errors.New("enforcer is required")
+	}
+
+	if (c.SubjectFunc != nil || c.SubjectFromIP) && c.RolesFunc != nil {
+		return errors.New("SubjectFunc and RolesFunc are mutually exclusive")
+	}
+
+	durations := []struct {
+		name string
+		d    time.Duration
+	}{
+		{"RetryAfter", c.RetryAfter},
+		{"EnforceTimeout", c.EnforceTimeout},
+		{"WatchInterval", c.WatchInterval},
+		{"CacheTTL", c.CacheTTL},
+	}
+	for _, v := range durations {
+		if v.d < 0 {
+			return fmt.Errorf("%s must not be negative, got %s", v.name, v.d)
+		}
+	}
+
+	if c.CacheSize < 0 {
+		return fmt.Errorf("CacheSize must not be negative, got %d", c.CacheSize)
+	}
+
+	if c.ForbiddenStatusCode != 0 && (c.ForbiddenStatusCode < 400 || c.ForbiddenStatusCode > 599) {
+		return fmt.Errorf("ForbiddenStatusCode must be a 4xx or 5xx status code, got %d", c.ForbiddenStatusCode)
+	}
+
+	if c.SubjectFormat != "" && c.DomainFunc == nil {
+		return errors.New("SubjectFormat requires a DomainFunc")
+	}
+
+	if c.EmptyRolesBehavior < EmptyRolesUseDefaultRole || c.EmptyRolesBehavior > EmptyRolesAllow {
+		return fmt.Errorf("unknown EmptyRolesBehavior %d", c.EmptyRolesBehavior)
+	}
+
+	if !isNil(c.Enforcer) {
+		if err := c.validateRequestTokens(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validateRequestTokens checks that the request definition of the model
+// of the Enforcer has as many tokens as the middleware supplies.
+func (c Config) validateRequestTokens() error {
+	m := c.Enforcer.GetModel()
+	if m == nil || m["r"] == nil || m["r"]["r"] == nil {
+		return nil
+	}
+
+	expected := len(m["r"]["r"].Tokens)
+	supplied := 3
+	if c.DomainFunc != nil && c.SubjectFormat == "" {
+		supplied = 4
+	}
+	if expected == supplied {
+		return nil
+	}
+
+	err := fmt.Sprintf("model expects %d request tokens but middleware supplies %d", expected, supplied)
+	switch {
+	case expected == 4 && c.DomainFunc == nil:
+		err += "; set DomainFunc"
+	case expected == 4:
+		err += "; unset SubjectFormat"
+	case expected == 3 && supplied == 4:
+		err += "; unset DomainFunc or set SubjectFormat"
+	}
+	return errors.New(err)
+}
+
+func Casbin(ce casbin.IEnforcer) echo.MiddlewareFunc {
+	c := NewDefaultConfig()
 	c.Enforcer = ce
 	return CasbinWithConfig(c)
 }
 
+// CasbinFromFiles returns the middleware with the DefaultConfig
+// and an enforcer built from the model and policy files.
+func CasbinFromFiles(modelPath string, policyPath string) (echo.MiddlewareFunc, error) {
+	ce, err := casbin.NewEnforcer(modelPath, policyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return Casbin(ce), nil
+}
+
 func CasbinWithConfig(config Config) echo.MiddlewareFunc {
 	if config.Skipper == nil {
 		config.Skipper = DefaultConfig.Skipper
 	}
 
-	if config.Enforcer == nil {
-		panic("enforcer is required")
+	if err := config.Validate(); err != nil {
+		panic(err.Error())
+	}
+
+	if config.SubjectFromIP && config.SubjectFunc == nil {
+		config.SubjectFunc = func(c echo.Context) (interface{}, error) {
+			return c.RealIP(), nil
+		}
 	}
 
 	if config.ContextKey == "" {
@@ -99,100 +830,394 @@ func CasbinWithConfig(config Config) echo.MiddlewareFunc {
 		config.DefaultRole = DefaultConfig.DefaultRole
 	}
 
+	if config.DenyOnEmptyRoles {
+		config.EmptyRolesBehavior = EmptyRolesDeny
+	}
+
+	if len(config.DefaultRoles) < 1 {
+		config.DefaultRoles = []string{config.DefaultRole}
+	} else {
+		config.DefaultRoles = append([]string(nil), config.DefaultRoles...)
+	}
+
+	if config.SubjectContextKey == "" {
+		config.SubjectContextKey = DefaultConfig.SubjectContextKey
+	}
+
 	if config.RolesHeader == "" {
 		config.RolesHeader = DefaultConfig.RolesHeader
 	}
 
+	if config.ObjectsHeader == "" {
+		config.ObjectsHeader = DefaultConfig.ObjectsHeader
+	}
+
+	if config.RolesHeaderDelimiter == "" {
+		config.RolesHeaderDelimiter = DefaultConfig.RolesHeaderDelimiter
+	}
+
+	if config.ObjectsHeaderDelimiter == "" {
+		config.ObjectsHeaderDelimiter = DefaultConfig.ObjectsHeaderDelimiter
+	}
+
+	if config.PermittedActionsKey == "" {
+		config.PermittedActionsKey = DefaultConfig.PermittedActionsKey
+	}
+
+	if config.CapabilitiesKey == "" {
+		config.CapabilitiesKey = DefaultConfig.CapabilitiesKey
+	}
+
+	if config.CapabilitiesHeader == "" {
+		config.CapabilitiesHeader = DefaultConfig.CapabilitiesHeader
+	}
+
+	if config.DecisionTrailer == "" {
+		config.DecisionTrailer = DefaultConfig.DecisionTrailer
+	}
+
+	if config.ResolvedRolesKey == "" {
+		config.ResolvedRolesKey = DefaultConfig.ResolvedRolesKey
+	}
+
+	if config.AuthorizedRoleKey == "" {
+		config.AuthorizedRoleKey = DefaultConfig.AuthorizedRoleKey
+	}
+
+	if config.AuthorizedRoleHeader == "" {
+		config.AuthorizedRoleHeader = DefaultConfig.AuthorizedRoleHeader
+	}
+
+	if config.MatchedPolicyKey == "" {
+		config.MatchedPolicyKey = DefaultConfig.MatchedPolicyKey
+	}
+
+	if config.MaintenanceMessage == "" {
+		config.MaintenanceMessage = DefaultConfig.MaintenanceMessage
+	}
+
 	if config.ForbiddenMessage == "" {
 		config.ForbiddenMessage = DefaultConfig.ForbiddenMessage
 	}
 
+	if config.ForbiddenResponseField == "" {
+		config.ForbiddenResponseField = DefaultConfig.ForbiddenResponseField
+	}
+
+	if config.ForbiddenStatusCode == 0 {
+		config.ForbiddenStatusCode = DefaultConfig.ForbiddenStatusCode
+	}
+
+	if config.Realm == "" {
+		config.Realm = DefaultConfig.Realm
+	}
+
+	if config.CacheSize == 0 {
+		config.CacheSize = DefaultConfig.CacheSize
+	}
+
+	var cache, groups *decisionCache
+	if config.CacheTTL > 0 && config.EnforcerFunc == nil {
+		cache = newDecisionCache(config.CacheSize, config.CacheTTL)
+	}
+	if config.CacheTTL > 0 && config.GroupProvider != nil {
+		groups = newDecisionCache(config.CacheSize, config.CacheTTL)
+	}
+
+	if config.PolicyFile != "" && config.WatchInterval > 0 && !isNil(config.Enforcer) {
+		ctx := config.WatchContext
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		if config.ReloadLock == nil && !isSynced(config.Enforcer) {
+			config.ReloadLock = &ReloadLock
+		}
+		watchPolicyFile(ctx, config.Enforcer, config.PolicyFile, config.WatchInterval, func() {
+			if cache != nil {
+				cache.clear()
+			}
+		})
+	}
+
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
-			if config.Skipper(c) {
+			if config.Skipper(c) || (config.SkipOptions && c.Request().Method == http.MethodOptions) ||
+				!isEnforcedMethod(config.EnforcedMethods, c.Request().Method) ||
+				(config.SkipUnmatchedRoutes && c.Path() == "") ||
+				isPublicEndpoint(config.PublicEndpoints, c.Request().Method, c.Path()) {
 				return next(c)
 			}
 
-			var roles []string
-			if config.RolesFunc != nil {
+			if isReadOnly(&config) && !isSafeMethod(c.Request().Method) {
+				if config.RetryAfter > 0 {
+					retryAfter := strconv.Itoa(int(math.Ceil(config.RetryAfter.Seconds())))
+					c.Response().Header().Set(echo.HeaderRetryAfter, retryAfter)
+				}
+				return echo.NewHTTPError(http.StatusServiceUnavailable, config.MaintenanceMessage)
+			}
+
+			var (
+				roles   []string
+				subject interface{}
+			)
+			if config.SubjectFunc != nil {
 				var err error
-				roles, err = config.RolesFunc(c)
+				subject, err = config.SubjectFunc(c)
 				if err != nil {
 					return err
 				}
-			} else {
-				var ok bool
-				k := c.Get(config.ContextKey)
-				if k != nil {
-					switch k.(type) {
-					case []string:
-						roles = k.([]string)
-						ok = true
-					case []interface{}:
-						for _, role := range k.([]interface{}) {
-							_, str := role.(string)
-							if str {
-								roles = append(roles, role.(string))
-							}
-						}
-						ok = true
-					}
-				}
-
-				if !ok {
-					roles = []string{}
+				if sub, ok := subject.(string); ok && config.NormalizeSubject != nil {
+					subject = config.NormalizeSubject(sub)
 				}
-
-				if len(roles) < 1 && config.EnableRolesHeader {
-					rolesHeader := c.Request().Header.Get(config.RolesHeader)
-
-					if rolesHeader == "" {
-						rolesHeader = config.DefaultRole
-					}
-
-					if config.RolesHeaderFunc != nil {
-						var err error
-						roles, err = config.RolesHeaderFunc(rolesHeader)
-						if err != nil {
-							return err
-						}
-					} else {
-						for _, role := range strings.Split(rolesHeader, ",") {
-							role = strings.TrimSpace(role)
-							roles = append(roles, role)
-						}
-					}
+			} else {
+				var err error
+				roles, err = resolveRoles(c, &config, groups)
+				if err != nil {
+					return err
 				}
 			}
+			c.Set(config.ResolvedRolesKey, roles)
 
-			if len(roles) < 1 {
-				roles = append(roles, config.DefaultRole)
+			if len(roles) < 1 && config.SubjectFunc == nil && config.EmptyRolesBehavior == EmptyRolesAllow {
+				return next(c)
+			}
+
+			a := &authorizer{
+				c:        c,
+				ctx:      c.Request().Context(),
+				config:   &config,
+				cache:    cache,
+				enforcer: config.Enforcer,
+				subject:  subject,
+				roles:    roles,
+			}
+			if config.PolicyGeneration != nil {
+				a.generation = atomic.LoadUint64(config.PolicyGeneration)
+			}
+			if config.EnforcerFunc != nil {
+				var err error
+				a.enforcer, err = config.EnforcerFunc(c)
+				if err != nil {
+					return err
+				}
+				if isNil(a.enforcer) {
+					return echo.NewHTTPError(http.StatusInternalServerError).
+						SetInternal(errors.New("casbin: EnforcerFunc returned a nil enforcer"))
+				}
+			}
+			if config.MatcherFunc != nil {
+				a.matcher = config.MatcherFunc(c)
+			}
+			if config.DomainFunc != nil {
+				var err error
+				a.domain, err = config.DomainFunc(c)
+				if err != nil {
+					return err
+				}
 			}
 
 			obj := c.Path()
+			if config.ObjectTemplate != "" {
+				obj = renderObjectTemplate(c, config.ObjectTemplate)
+			} else if config.UseRequestURI {
+				obj = c.Request().URL.Path
+			}
+
+			if config.ObjectFunc != nil {
+				var err error
+				obj, err = config.ObjectFunc(c)
+				if err != nil {
+					return err
+				}
+			}
+
+			if config.TrimPrefix != "" {
+				obj = trimPrefix(obj, config.TrimPrefix)
+			}
+
+			if config.TrimTrailingSlash && len(obj) > 1 {
+				obj = strings.TrimSuffix(obj, "/")
+			}
+
 			act := c.Request().Method
+			if config.NormalizeMethod {
+				act = strings.ToUpper(act)
+			}
 
-			var authorized bool
-			for _, role := range roles {
-				pass, err := config.Enforcer.Enforce(role, obj, act)
+			if config.ActionFunc != nil {
+				var err error
+				act, err = config.ActionFunc(c)
 				if err != nil {
 					return err
 				}
+			}
+
+			objs := []string{obj}
+			if config.EnableObjectsHeader {
+				objectsHeader := c.Request().Header.Get(config.ObjectsHeader)
+				if objectsHeader != "" {
+					for _, o := range strings.Split(objectsHeader, config.ObjectsHeaderDelimiter) {
+						// Skip the empty entries, e.g. "/a,,/b" or a trailing delimiter.
+						if o = strings.TrimSpace(o); o != "" {
+							objs = append(objs, o)
+						}
+					}
+				}
+			}
+
+			if config.NormalizeObject != nil {
+				for i, o := range objs {
+					objs[i] = config.NormalizeObject(o)
+				}
+				obj = objs[0]
+			}
+
+			// The subject is enforced once in place of the roles.
+			subjects := roles
+			if config.SubjectFunc != nil {
+				subjects = []string{""}
+			}
+
+			var (
+				denied  []decision
+				matched decision
+				err     error
+			)
+			if config.EnforceTimeout > 0 {
+				denied, matched, err = a.enforceWithTimeout(subjects, objs, act)
+			} else {
+				denied, matched, err = a.enforceObjects(subjects, objs, act)
+			}
+			if err != nil {
+				return err
+			}
+
+			if config.OnDecision != nil {
+				if len(denied) > 0 {
+					config.OnDecision(c, false, roles, denied[0].obj, denied[0].act)
+				} else {
+					config.OnDecision(c, true, roles, matched.obj, matched.act)
+				}
+			}
+
+			if len(denied) > 0 {
+				for _, d := range denied {
+					if config.FailureFunc != nil {
+						config.FailureFunc(roles, d.obj, d.act)
+					}
+					if config.OnDeny != nil {
+						config.OnDeny(c, roles, d.obj, d.act)
+					}
+				}
+
+				if config.MetricsCollector != nil {
+					for _, d := range denied {
+						config.MetricsCollector.IncDenied(roles, d.obj, d.act)
+					}
+				}
+
+				if config.AuditLogger != nil {
+					for _, d := range denied {
+						a.audit(roles, d)
+					}
+				}
+
+				if config.ErrorHandler != nil {
+					return config.ErrorHandler(c, roles, denied[0].obj, denied[0].act)
+				}
+
+				if config.ForbiddenStatusCode == http.StatusUnauthorized {
+					c.Response().Header().Set(echo.HeaderWWWAuthenticate, "Bearer realm="+strconv.Quote(config.Realm))
+				}
+
+				if prefersText(c.Request().Header.Get(echo.HeaderAccept)) {
+					// The error is still returned for the middlewares
+					// before this one, the HTTPErrorHandler sees the
+					// response is committed and doesn't write it again.
+					if err := c.String(config.ForbiddenStatusCode, config.ForbiddenMessage); err != nil {
+						return err
+					}
+					return echo.NewHTTPError(config.ForbiddenStatusCode, config.ForbiddenMessage)
+				}
 
-				if pass {
-					authorized = true
-					if config.SuccessFunc != nil {
-						config.SuccessFunc(role, obj, act)
+				if config.ForbiddenResponseField != "message" {
+					body := map[string]string{config.ForbiddenResponseField: config.ForbiddenMessage}
+					if config.IncludeDetailsInError {
+						body["object"] = denied[0].obj
+						body["action"] = denied[0].act
 					}
-					break
+					return echo.NewHTTPError(config.ForbiddenStatusCode, body)
+				}
+
+				if config.IncludeDetailsInError {
+					return echo.NewHTTPError(config.ForbiddenStatusCode, errorDetails{
+						Message: config.ForbiddenMessage,
+						Object:  denied[0].obj,
+						Action:  denied[0].act,
+					})
 				}
+
+				err := echo.NewHTTPError(config.ForbiddenStatusCode, config.ForbiddenMessage)
+				return err
 			}
 
-			if !authorized {
-				if config.FailureFunc != nil {
-					config.FailureFunc(roles, obj, act)
+			if config.AuditLogger != nil {
+				a.audit(roles, matched)
+			}
+
+			if config.AfterAllow != nil {
+				err := a.afterAllow(matched)
+				if err != nil && config.FailOnAfterAllowError {
+					return echo.NewHTTPError(http.StatusInternalServerError).SetInternal(err)
 				}
-				err := echo.NewHTTPError(http.StatusForbidden, config.ForbiddenMessage)
+			}
+
+			if config.MatchAllRoles {
+				c.Set(config.AuthorizedRoleKey, roles)
+			} else {
+				c.Set(config.AuthorizedRoleKey, matched.role)
+			}
+
+			if config.EnableAuthorizedRoleHeader {
+				role := matched.role
+				if config.MatchAllRoles {
+					role = strings.Join(roles, ",")
+				}
+				c.Response().Header().Set(config.AuthorizedRoleHeader, role)
+			}
+
+			if config.EnableExplain {
+				c.Set(config.MatchedPolicyKey, matched.rule)
+			}
+
+			if len(config.PermittedActions) > 0 {
+				permitted, err := a.permittedActions(subjects, obj, config.PermittedActions)
+				if err != nil {
+					return err
+				}
+				c.Set(config.PermittedActionsKey, permitted)
+			}
+
+			if len(config.Capabilities) > 0 {
+				caps, err := a.capabilities(subjects, config.Capabilities)
+				if err != nil {
+					return err
+				}
+				c.Set(config.CapabilitiesKey, caps)
+
+				if config.EnableCapabilitiesHeader {
+					b, err := json.Marshal(caps)
+					if err != nil {
+						return err
+					}
+					c.Response().Header().Set(config.CapabilitiesHeader, string(b))
+				}
+			}
+
+			if config.EnableDecisionTrailer {
+				c.Response().Header().Add("Trailer", config.DecisionTrailer)
+				err := next(c)
+				c.Response().Header().Set(config.DecisionTrailer, "allowed")
 				return err
 			}
 
@@ -200,3 +1225,929 @@ func CasbinWithConfig(config Config) echo.MiddlewareFunc {
 		}
 	}
 }
+
+// errorDetails is the error message when IncludeDetailsInError is set.
+type errorDetails struct {
+	Message string `json:"message"`
+	Object  string `json:"object"`
+	Action  string `json:"action"`
+}
+
+// authorizer enforces the policies for a single request.
+type authorizer struct {
+	c          echo.Context
+	ctx        context.Context
+	config     *Config
+	cache      *decisionCache
+	enforcer   casbin.IEnforcer
+	domain     string
+	subject    interface{}
+	matcher    string
+	roles      []string
+	generation uint64
+
+	// rewrites holds the results of the BeforeEnforce, by role, object
+	// and action, when it ran before enforcing in another goroutine.
+	rewrites map[[3]string][3]string
+
+	// deferred holds the hooks to run once the enforcement completes
+	// when it runs in another goroutine, which may outlive the request.
+	deferred *[]func()
+
+	// allows holds the authorized roles, objects and actions
+	// until all the objects of the request were enforced.
+	allows *[][3]string
+}
+
+// rvals returns the request values passed to the Enforcer.
+// The subject of the SubjectFunc replaces sub if it's set.
+func (a *authorizer) rvals(sub string, obj string, act string) []interface{} {
+	var s interface{} = sub
+	if a.config.SubjectFunc != nil {
+		s = a.subject
+	}
+	if a.config.DomainFunc != nil {
+		if a.config.SubjectFormat != "" {
+			return []interface{}{a.formatSubject(sub), obj, act}
+		}
+		return []interface{}{s, a.domain, obj, act}
+	}
+	return []interface{}{s, obj, act}
+}
+
+// formatSubject renders the SubjectFormat with the domain and role.
+func (a *authorizer) formatSubject(role string) string {
+	return strings.NewReplacer("{domain}", a.domain, "{role}", role).Replace(a.config.SubjectFormat)
+}
+
+// decision is the outcome of enforcing an object and action.
+// The object and action are the ones that were last passed to the
+// Enforcer, after being rewritten by the BeforeEnforce.
+type decision struct {
+	allowed bool
+	role    string
+	rule    []string
+	obj     string
+	act     string
+}
+
+// enforce reports whether any of the roles, or all of them
+// if MatchAllRoles is set, is authorized to perform act on obj.
+// It returns the error of the request context if it's done
+// before all the roles were enforced.
+func (a *authorizer) enforce(roles []string, obj string, act string) (decision, error) {
+	d := decision{obj: obj, act: act}
+	if len(roles) < 1 {
+		return d, nil
+	}
+
+	if a.hasSuperRole(roles) {
+		a.allow(a.config.SuperRole, obj, act)
+		d.allowed, d.role = true, a.config.SuperRole
+		return d, nil
+	}
+
+	if a.config.UseBatchEnforce && !a.config.EnableExplain {
+		bd, ok, err := a.enforceBatch(roles, obj, act)
+		if err != nil || ok {
+			return bd, err
+		}
+	}
+
+	var authorized [][3]string
+	for _, role := range roles {
+		// Stop enforcing if the client went away or the timeout expired.
+		if err := a.ctx.Err(); err != nil {
+			return decision{}, err
+		}
+
+		sub, o, ac, err := a.beforeEnforce(role, obj, act)
+		if err != nil {
+			return decision{}, err
+		}
+		d.obj, d.act = o, ac
+
+		pass, rule, err := a.call(a.rvals(sub, o, ac))
+		if err != nil {
+			if !a.config.FailOpen {
+				return decision{}, err
+			}
+			a.enforceError(sub, o, ac, err)
+			pass = true
+		}
+		d.rule = rule
+
+		if a.config.EnableExplain && a.config.ExplainFunc != nil {
+			a.explain(pass, sub, rule, o, ac)
+		}
+
+		if a.config.MatchAllRoles {
+			if !pass {
+				return d, nil
+			}
+			authorized = append(authorized, [3]string{sub, o, ac})
+			continue
+		}
+
+		if pass {
+			a.allow(sub, o, ac)
+			d.allowed, d.role = true, role
+			return d, nil
+		}
+	}
+
+	if a.config.MatchAllRoles {
+		for _, v := range authorized {
+			a.allow(v[0], v[1], v[2])
+		}
+		d.allowed = true
+		return d, nil
+	}
+
+	return d, nil
+}
+
+// enforceBatch is enforce with a single BatchEnforce call for all the
+// roles. It reports false if BatchEnforce failed, to fall back to enforce.
+func (a *authorizer) enforceBatch(roles []string, obj string, act string) (decision, bool, error) {
+	requests := make([][]interface{}, 0, len(roles))
+	vals := make([][3]string, 0, len(roles))
+	for _, role := range roles {
+		sub, o, ac, err := a.beforeEnforce(role, obj, act)
+		if err != nil {
+			return decision{}, false, err
+		}
+		requests = append(requests, a.rvals(sub, o, ac))
+		vals = append(vals, [3]string{sub, o, ac})
+	}
+
+	results, err := a.batch(requests)
+	if err != nil {
+		return decision{}, false, nil
+	}
+
+	d := decision{obj: obj, act: act}
+	for i, pass := range results {
+		v := vals[i]
+		d.obj, d.act = v[1], v[2]
+
+		if a.config.MatchAllRoles {
+			if !pass {
+				return d, true, nil
+			}
+			continue
+		}
+
+		if pass {
+			a.allow(v[0], v[1], v[2])
+			d.allowed, d.role = true, roles[i]
+			return d, true, nil
+		}
+	}
+
+	if a.config.MatchAllRoles {
+		for _, v := range vals {
+			a.allow(v[0], v[1], v[2])
+		}
+		d.allowed = true
+	}
+
+	return d, true, nil
+}
+
+// hasSuperRole reports whether the roles include the SuperRole.
+func (a *authorizer) hasSuperRole(roles []string) bool {
+	if a.config.SuperRole == "" || a.config.SubjectFunc != nil {
+		return false
+	}
+
+	for _, role := range roles {
+		if role == a.config.SuperRole {
+			return true
+		}
+	}
+
+	return false
+}
+
+// beforeEnforce returns the subject, object and action to enforce
+// for the role, as rewritten by the BeforeEnforce if it's set.
+func (a *authorizer) beforeEnforce(role string, obj string, act string) (string, string, string, error) {
+	if a.config.BeforeEnforce == nil || a.config.SubjectFunc != nil {
+		return role, obj, act, nil
+	}
+
+	if a.rewrites != nil {
+		v := a.rewrites[[3]string{role, obj, act}]
+		return v[0], v[1], v[2], nil
+	}
+
+	return a.rewrite(role, obj, act)
+}
+
+// rewrite runs the BeforeEnforce and normalizes the object
+// it returns with the NormalizeObject if it was rewritten.
+func (a *authorizer) rewrite(role string, obj string, act string) (string, string, string, error) {
+	sub, o, ac, err := a.config.BeforeEnforce(a.c, role, obj, act)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	if o != obj && a.config.NormalizeObject != nil {
+		o = a.config.NormalizeObject(o)
+	}
+
+	return sub, o, ac, nil
+}
+
+// enforceError runs the OnEnforceError, if it's set.
+func (a *authorizer) enforceError(sub string, obj string, act string, err error) {
+	if a.config.OnEnforceError == nil {
+		return
+	}
+
+	if a.deferred != nil {
+		*a.deferred = append(*a.deferred, func() { a.config.OnEnforceError(a.c, sub, obj, act, err) })
+		return
+	}
+
+	a.config.OnEnforceError(a.c, sub, obj, act, err)
+}
+
+// explain runs the ExplainFunc.
+func (a *authorizer) explain(pass bool, sub string, rule []string, obj string, act string) {
+	if a.deferred != nil {
+		*a.deferred = append(*a.deferred, func() { a.config.ExplainFunc(pass, sub, rule, obj, act) })
+		return
+	}
+
+	a.config.ExplainFunc(pass, sub, rule, obj, act)
+}
+
+// allow runs the SuccessFunc, OnAllow and MetricsCollector for an authorized role.
+func (a *authorizer) allow(role string, obj string, act string) {
+	if a.allows != nil {
+		*a.allows = append(*a.allows, [3]string{role, obj, act})
+		return
+	}
+	if a.deferred != nil {
+		*a.deferred = append(*a.deferred, func() { a.allowed(role, obj, act) })
+		return
+	}
+
+	a.allowed(role, obj, act)
+}
+
+func (a *authorizer) allowed(role string, obj string, act string) {
+	if a.config.SuccessFunc != nil {
+		a.config.SuccessFunc(role, obj, act)
+	}
+	if a.config.OnAllow != nil {
+		a.config.OnAllow(a.c, role, a.roles, obj, act)
+	}
+	if a.config.MetricsCollector != nil {
+		a.config.MetricsCollector.IncAllowed(role, obj, act)
+	}
+}
+
+// afterAllow runs the AfterAllow for every role authorized by d.
+func (a *authorizer) afterAllow(d decision) error {
+	var roles []string
+	switch {
+	case a.config.SubjectFunc != nil:
+		sub, ok := a.subject.(string)
+		if !ok {
+			return nil
+		}
+		roles = []string{sub}
+	case d.role != "":
+		roles = []string{d.role}
+	default:
+		roles = a.roles
+	}
+
+	for _, role := range roles {
+		if err := a.config.AfterAllow(a.c, a.enforcer, role, d.obj, d.act); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// audit logs the decision to the AuditLogger.
+func (a *authorizer) audit(roles []string, d decision) {
+	a.config.AuditLogger.Log(AuditEntry{
+		Roles:    roles,
+		Object:   d.obj,
+		Action:   d.act,
+		Allowed:  d.allowed,
+		Rule:     d.rule,
+		RemoteIP: a.c.RealIP(),
+		TraceID:  a.traceID(),
+		Time:     time.Now(),
+	})
+}
+
+// traceID returns the trace ID set on the echo.Context under the TraceIDKey.
+func (a *authorizer) traceID() string {
+	if a.config.TraceIDKey == "" {
+		return ""
+	}
+
+	switch v := a.c.Get(a.config.TraceIDKey).(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// call calls the Enforcer with the request values,
+// going through the cache if enabled.
+func (a *authorizer) call(rvals []interface{}) (bool, []string, error) {
+	var key string
+	if a.cache != nil {
+		vals := rvals
+		if a.matcher != "" {
+			vals = append([]interface{}{a.matcher}, vals...)
+		}
+		if a.config.PolicyGeneration != nil {
+			vals = append([]interface{}{strconv.FormatUint(a.generation, 10)}, vals...)
+		}
+
+		var ok bool
+		key, ok = cacheKey(vals)
+		if ok {
+			if pass, rule, found := a.cache.get(key); found {
+				return pass, rule, nil
+			}
+		}
+	}
+
+	var (
+		pass bool
+		rule []string
+		err  error
+	)
+	if a.config.ReloadLock != nil {
+		a.config.ReloadLock.RLock()
+		defer a.config.ReloadLock.RUnlock()
+	}
+
+	switch {
+	case a.matcher != "" && a.config.EnableExplain:
+		pass, rule, err = a.enforcer.EnforceExWithMatcher(a.matcher, rvals...)
+	case a.matcher != "":
+		pass, err = a.enforcer.EnforceWithMatcher(a.matcher, rvals...)
+	case a.config.EnableExplain:
+		pass, rule, err = a.enforcer.EnforceEx(rvals...)
+	default:
+		pass, err = a.enforcer.Enforce(rvals...)
+	}
+	if err != nil {
+		return false, nil, err
+	}
+
+	if key != "" {
+		a.cache.set(key, pass, rule)
+	}
+
+	return pass, rule, nil
+}
+
+// enforceObjects enforces act on every object and returns the
+// decisions that were denied along with the decision for the first object.
+// The allow hooks only run for the first object, once all of them passed.
+func (a *authorizer) enforceObjects(roles []string, objs []string, act string) ([]decision, decision, error) {
+	var (
+		denied  []decision
+		matched decision
+		allows  [][3]string
+	)
+	for i, obj := range objs {
+		var pending [][3]string
+		a.allows = &pending
+		d, err := a.enforce(roles, obj, act)
+		a.allows = nil
+		if err != nil {
+			return nil, decision{}, err
+		}
+
+		if !d.allowed {
+			denied = append(denied, d)
+		} else if i == 0 {
+			matched = d
+			allows = pending
+		}
+	}
+
+	if len(denied) < 1 {
+		for _, v := range allows {
+			a.allow(v[0], v[1], v[2])
+		}
+	}
+
+	return denied, matched, nil
+}
+
+// enforceWithTimeout runs enforceObjects in a goroutine and returns
+// a 503 if it doesn't complete within the EnforceTimeout. The goroutine
+// may outlive the request, so it doesn't use the echo.Context: the
+// BeforeEnforce runs upfront and the other hooks once it completes.
+func (a *authorizer) enforceWithTimeout(roles []string, objs []string, act string) ([]decision, decision, error) {
+	ctx, cancel := context.WithTimeout(a.ctx, a.config.EnforceTimeout)
+	defer cancel()
+
+	g := *a
+	g.ctx = ctx
+	if a.config.BeforeEnforce != nil && a.config.SubjectFunc == nil {
+		g.rewrites = make(map[[3]string][3]string, len(roles)*len(objs))
+		for _, obj := range objs {
+			for _, role := range roles {
+				sub, o, ac, err := a.rewrite(role, obj, act)
+				if err != nil {
+					return nil, decision{}, err
+				}
+				g.rewrites[[3]string{role, obj, act}] = [3]string{sub, o, ac}
+			}
+		}
+	}
+
+	type result struct {
+		denied   []decision
+		matched  decision
+		deferred []func()
+		err      error
+	}
+
+	done := make(chan result, 1)
+	go func(g authorizer) {
+		var deferred []func()
+		g.deferred = &deferred
+		denied, matched, err := g.enforceObjects(roles, objs, act)
+		done <- result{denied, matched, deferred, err}
+	}(g)
+
+	select {
+	case r := <-done:
+		if r.err != nil && ctx.Err() != nil {
+			return nil, decision{}, echo.NewHTTPError(http.StatusServiceUnavailable).SetInternal(ctx.Err())
+		}
+		for _, fn := range r.deferred {
+			fn()
+		}
+		return r.denied, r.matched, r.err
+	case <-ctx.Done():
+		return nil, decision{}, echo.NewHTTPError(http.StatusServiceUnavailable).SetInternal(ctx.Err())
+	}
+}
+
+// batch calls BatchEnforce with the requests.
+func (a *authorizer) batch(requests [][]interface{}) ([]bool, error) {
+	if a.config.ReloadLock != nil {
+		a.config.ReloadLock.RLock()
+		defer a.config.ReloadLock.RUnlock()
+	}
+
+	if a.matcher != "" {
+		return a.enforcer.BatchEnforceWithMatcher(a.matcher, requests)
+	}
+	return a.enforcer.BatchEnforce(requests)
+}
+
+// permittedActions evaluates every action for obj across all roles
+// in a single BatchEnforce call.
+func (a *authorizer) permittedActions(roles []string, obj string, actions []string) (map[string]bool, error) {
+	permitted, err := a.capabilities(roles, map[string][]string{obj: actions})
+	if err != nil {
+		return nil, err
+	}
+
+	return permitted[obj], nil
+}
+
+// capabilities evaluates every action of every object across all
+// roles in a single BatchEnforce call, respecting MatchAllRoles.
+func (a *authorizer) capabilities(roles []string, matrix map[string][]string) (map[string]map[string]bool, error) {
+	if a.hasSuperRole(roles) {
+		caps := make(map[string]map[string]bool, len(matrix))
+		for obj, actions := range matrix {
+			caps[obj] = make(map[string]bool, len(actions))
+			for _, act := range actions {
+				caps[obj][act] = true
+			}
+		}
+		return caps, nil
+	}
+
+	var (
+		requests [][]interface{}
+		pairs    [][2]string
+	)
+	for obj, actions := range matrix {
+		for _, act := range actions {
+			for _, role := range roles {
+				requests = append(requests, a.rvals(role, obj, act))
+				pairs = append(pairs, [2]string{obj, act})
+			}
+		}
+	}
+
+	results, err := a.batch(requests)
+	if err != nil {
+		return nil, err
+	}
+
+	caps := make(map[string]map[string]bool, len(matrix))
+	for i, pair := range pairs {
+		obj, act := pair[0], pair[1]
+		if caps[obj] == nil {
+			caps[obj] = make(map[string]bool, len(matrix[obj]))
+		}
+
+		permitted, seen := caps[obj][act]
+		switch {
+		case !seen:
+			caps[obj][act] = results[i]
+		case a.config.MatchAllRoles:
+			caps[obj][act] = permitted && results[i]
+		default:
+			caps[obj][act] = permitted || results[i]
+		}
+	}
+
+	return caps, nil
+}
+
+// defaultRoles returns a copy of the DefaultRoles, which CasbinWithConfig
+// sets to the DefaultRole if they're empty. The copy keeps the roles set
+// on the echo.Context, or passed to the hooks, from modifying the defaults.
+func defaultRoles(config *Config) []string {
+	return append([]string(nil), config.DefaultRoles...)
+}
+
+// resolveRoles returns the deduplicated roles of the request
+// from the configured sources, falling back to the default roles.
+// The roles of the GroupProvider go through the groups cache if it's set.
+func resolveRoles(c echo.Context, config *Config, groups *decisionCache) ([]string, error) {
+	var roles []string
+	if config.RolesFunc != nil {
+		var err error
+		roles, err = config.RolesFunc(c)
+		if err != nil {
+			return nil, err
+		}
+	} else if config.GroupProvider != nil {
+		subject, _ := c.Get(config.SubjectContextKey).(string)
+		if subject != "" {
+			if config.NormalizeSubject != nil {
+				subject = config.NormalizeSubject(subject)
+			}
+
+			var err error
+			roles, err = groupsFor(c, config, groups, subject)
+			if err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		if len(config.ContextKeys) > 0 {
+			for _, key := range config.ContextKeys {
+				r, err := rolesFromContext(c, config, key)
+				if err != nil {
+					return nil, err
+				}
+				roles = mergeRoles(roles, r)
+			}
+		} else {
+			var err error
+			roles, err = rolesFromContext(c, config, config.ContextKey)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if len(roles) < 1 && config.EnableRolesHeader && !config.MergeRoleSources {
+			var err error
+			roles, err = rolesFromHeader(c, config)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if config.MergeRoleSources && config.EnableRolesHeader {
+		if len(roles) < 1 || c.Request().Header.Get(config.RolesHeader) != "" {
+			headerRoles, err := rolesFromHeader(c, config)
+			if err != nil {
+				return nil, err
+			}
+			roles = mergeRoles(roles, headerRoles)
+		}
+	}
+
+	if len(roles) < 1 && config.EmptyRolesBehavior == EmptyRolesUseDefaultRole {
+		roles = defaultRoles(config)
+	}
+
+	if config.NormalizeSubject != nil {
+		normalized := make([]string, 0, len(roles))
+		for _, role := range roles {
+			normalized = append(normalized, config.NormalizeSubject(role))
+		}
+		roles = normalized
+	}
+
+	return dedupeRoles(roles), nil
+}
+
+// groupsFor looks up the roles of the subject with the GroupProvider,
+// going through the groups cache if it's set, where they're stored
+// as the rule. The roles are copied as they end up on the context, so
+// modifying them doesn't modify the roles of the provider or the cache.
+func groupsFor(c echo.Context, config *Config, groups *decisionCache, subject string) ([]string, error) {
+	if groups != nil {
+		if _, roles, found := groups.get(subject); found {
+			return append([]string(nil), roles...), nil
+		}
+	}
+
+	roles, err := config.GroupProvider.GroupsFor(c.Request().Context(), subject)
+	if err != nil {
+		if config.OnEnforceError != nil {
+			config.OnEnforceError(c, subject, c.Path(), c.Request().Method, err)
+		}
+		return nil, err
+	}
+
+	if groups != nil {
+		groups.set(subject, true, append([]string(nil), roles...))
+	}
+
+	return append([]string(nil), roles...), nil
+}
+
+// rolesFromContext reads the roles set on the echo.Context under key
+// as a []string, a []interface{}, ignoring the non-string roles, or any
+// slice of a string type. Other types are passed to the RolesTypeFunc
+// if it's set, or result in no roles.
+func rolesFromContext(c echo.Context, config *Config, key string) ([]string, error) {
+	v := c.Get(key)
+	switch k := v.(type) {
+	case nil:
+		return []string{}, nil
+	case []string:
+		return k, nil
+	case []interface{}:
+		roles := make([]string, 0, len(k))
+		for _, role := range k {
+			if r, ok := role.(string); ok {
+				roles = append(roles, r)
+			}
+		}
+		return roles, nil
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() == reflect.String {
+		roles := make([]string, rv.Len())
+		for i := range roles {
+			roles[i] = rv.Index(i).String()
+		}
+		return roles, nil
+	}
+
+	if config.RolesTypeFunc != nil {
+		return config.RolesTypeFunc(v)
+	}
+
+	return []string{}, nil
+}
+
+// rolesFromHeader reads the roles from the RolesHeader, falling back
+// to the default roles if the header is empty.
+func rolesFromHeader(c echo.Context, config *Config) ([]string, error) {
+	rolesHeader := c.Request().Header.Get(config.RolesHeader)
+
+	if rolesHeader == "" {
+		if config.EmptyRolesBehavior != EmptyRolesUseDefaultRole {
+			return []string{}, nil
+		}
+		if config.RolesHeaderFunc == nil && config.RolesHeaderFuncCtx == nil {
+			return defaultRoles(config), nil
+		}
+		rolesHeader = strings.Join(defaultRoles(config), config.RolesHeaderDelimiter)
+	}
+
+	if config.RolesHeaderFuncCtx != nil {
+		return config.RolesHeaderFuncCtx(c, rolesHeader)
+	}
+
+	if config.RolesHeaderFunc != nil {
+		return config.RolesHeaderFunc(rolesHeader)
+	}
+
+	roles := strings.Split(rolesHeader, config.RolesHeaderDelimiter)
+	for i, role := range roles {
+		roles[i] = strings.TrimSpace(role)
+	}
+
+	return roles, nil
+}
+
+// dedupeRoles returns the roles without duplicates, only
+// allocating a new slice if there are any.
+func dedupeRoles(roles []string) []string {
+	if len(roles) > 8 {
+		return mergeRoles(roles, nil)
+	}
+
+	for i := 1; i < len(roles); i++ {
+		for j := 0; j < i; j++ {
+			if roles[i] == roles[j] {
+				return mergeRoles(roles, nil)
+			}
+		}
+	}
+
+	return roles
+}
+
+// mergeRoles returns a new slice with the roles of a followed
+// by the roles of b that aren't already in it.
+func mergeRoles(a []string, b []string) []string {
+	merged := make([]string, 0, len(a)+len(b))
+	seen := make(map[string]struct{}, len(a)+len(b))
+	for _, roles := range [][]string{a, b} {
+		for _, role := range roles {
+			if _, ok := seen[role]; ok {
+				continue
+			}
+			seen[role] = struct{}{}
+			merged = append(merged, role)
+		}
+	}
+
+	return merged
+}
+
+// renderObjectTemplate replaces the ":param" tokens of tmpl,
+// which extend to the next "/", with the route params of c.
+func renderObjectTemplate(c echo.Context, tmpl string) string {
+	var b strings.Builder
+	b.Grow(len(tmpl))
+	for i := 0; i < len(tmpl); {
+		if tmpl[i] != ':' {
+			b.WriteByte(tmpl[i])
+			i++
+			continue
+		}
+
+		j := strings.IndexByte(tmpl[i:], '/')
+		if j < 0 {
+			j = len(tmpl)
+		} else {
+			j += i
+		}
+
+		if v := c.Param(tmpl[i+1 : j]); v != "" {
+			b.WriteString(v)
+		} else {
+			b.WriteString(tmpl[i:j])
+		}
+		i = j
+	}
+
+	return b.String()
+}
+
+// trimPrefix strips prefix from obj if it's a
+// path prefix of it, e.g. "/api" of "/api/users" but not "/apis".
+func trimPrefix(obj string, prefix string) string {
+	prefix = strings.TrimSuffix(prefix, "/")
+	if !strings.HasPrefix(obj, prefix) {
+		return obj
+	}
+
+	rest := obj[len(prefix):]
+	if rest != "" && rest[0] != '/' {
+		return obj
+	}
+
+	if rest == "" {
+		return "/"
+	}
+	return rest
+}
+
+// isNil reports whether the enforcer is nil, including
+// a nil pointer wrapped in the interface.
+func isNil(e casbin.IEnforcer) bool {
+	if e == nil {
+		return true
+	}
+	v := reflect.ValueOf(e)
+	return v.Kind() == reflect.Ptr && v.IsNil()
+}
+
+// prefersText reports whether the Accept header prefers
+// text/plain over JSON by the quality values of the most specific
+// media ranges matching them. Ties go to the media range listed
+// first, and to JSON if it's the same one, e.g. "*/*".
+func prefersText(accept string) bool {
+	if accept == "" {
+		return false
+	}
+
+	// Specificity of the matched media range, 0 if none matched,
+	// 1 for "*/*", 2 for "text/*" and 3 for "text/plain".
+	var (
+		textQ, jsonQ       float64
+		textSpec, jsonSpec int
+		textPos, jsonPos   int
+	)
+	for i, mediaRange := range strings.Split(accept, ",") {
+		mediaType, params, _ := strings.Cut(mediaRange, ";")
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			k, v, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if ok && strings.EqualFold(k, "q") {
+				if f, err := strconv.ParseFloat(v, 64); err == nil {
+					q = f
+				}
+			}
+		}
+
+		var tSpec, jSpec int
+		switch strings.ToLower(strings.TrimSpace(mediaType)) {
+		case echo.MIMETextPlain:
+			tSpec = 3
+		case "text/*":
+			tSpec = 2
+		case echo.MIMEApplicationJSON:
+			jSpec = 3
+		case "application/*":
+			jSpec = 2
+		case "*/*":
+			tSpec, jSpec = 1, 1
+		}
+
+		if tSpec > textSpec {
+			textQ, textSpec, textPos = q, tSpec, i
+		}
+		if jSpec > jsonSpec {
+			jsonQ, jsonSpec, jsonPos = q, jSpec, i
+		}
+	}
+
+	if textQ == jsonQ {
+		return textQ > 0 && textPos < jsonPos
+	}
+	return textQ > jsonQ
+}
+
+// isPublicEndpoint reports whether the method and path
+// match one of the endpoints.
+func isPublicEndpoint(endpoints []Endpoint, method string, path string) bool {
+	for _, e := range endpoints {
+		if e.Path == path && strings.EqualFold(e.Method, method) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isEnforcedMethod reports whether method is one of the
+// methods, or true if methods is empty.
+func isEnforcedMethod(methods []string, method string) bool {
+	if len(methods) < 1 {
+		return true
+	}
+
+	for _, m := range methods {
+		if strings.EqualFold(m, method) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isSafeMethod reports whether method is GET, HEAD or OPTIONS, in any case.
+func isSafeMethod(method string) bool {
+	return strings.EqualFold(method, http.MethodGet) ||
+		strings.EqualFold(method, http.MethodHead) ||
+		strings.EqualFold(method, http.MethodOptions)
+}
+
+// isReadOnly reports whether the read-only mode is enabled.
+func isReadOnly(config *Config) bool {
+	if config.ReadOnlyModeFunc != nil {
+		return config.ReadOnlyModeFunc()
+	}
+	return config.ReadOnlyMode
+}
@@ -1,15 +1,23 @@
 package casbin
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/casbin/casbin/v2"
 	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -41,6 +49,49 @@ func TestJWT(t *testing.T) {
 	assert.Equal(t, http.StatusOK, resp.Code)
 }
 
+func TestJWTFromFiles(t *testing.T) {
+	testCases := []struct {
+		name       string
+		model      string
+		policy     string
+		endpoint   string
+		statusCode int
+		err        bool
+	}{
+		{"root", "./fixtures/model.conf", "./fixtures/policy.csv", "/", http.StatusOK, false},
+		{"admin", "./fixtures/model.conf", "./fixtures/policy.csv", "/admin", http.StatusForbidden, false},
+		{"missing model", "./fixtures/missing.conf", "./fixtures/policy.csv", "/", 0, true},
+		{"missing policy", "./fixtures/model.conf", "./fixtures/missing.csv", "/", 0, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mw, err := CasbinFromFiles(tc.model, tc.policy)
+			if tc.err {
+				assert.Error(t, err)
+				assert.Nil(t, mw)
+				return
+			}
+			assert.NoError(t, err)
+
+			e := echo.New()
+
+			e.GET(tc.endpoint, func(c echo.Context) error {
+				return c.JSON(http.StatusOK, "ok")
+			})
+
+			e.Use(mw)
+
+			req := httptest.NewRequest(http.MethodGet, tc.endpoint, nil)
+			resp := httptest.NewRecorder()
+
+			e.ServeHTTP(resp, req)
+
+			assert.Equal(t, tc.statusCode, resp.Code)
+		})
+	}
+}
+
 type Response struct {
 	Message string `json:"message"`
 }
@@ -106,6 +157,47 @@ func TestJWTWithConfig_ForbiddenMessage(t *testing.T) {
 	assert.Equal(t, &Response{Message: DefaultConfig.ForbiddenMessage}, r)
 }
 
+func TestJWTWithConfig_ForbiddenStatusCode(t *testing.T) {
+	testCases := []struct {
+		name       string
+		code       int
+		statusCode int
+	}{
+		{"default", 0, http.StatusForbidden},
+		{"unauthorized", http.StatusUnauthorized, http.StatusUnauthorized},
+		{"not found", http.StatusNotFound, http.StatusNotFound},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+
+			e.GET("/user", func(c echo.Context) error {
+				return c.JSON(http.StatusOK, "ok")
+			})
+
+			config := Config{
+				Enforcer:            enforcer,
+				ForbiddenMessage:    "nope",
+				ForbiddenStatusCode: tc.code,
+			}
+			e.Use(CasbinWithConfig(config))
+
+			req := httptest.NewRequest(http.MethodGet, "/user", nil)
+			resp := httptest.NewRecorder()
+
+			e.ServeHTTP(resp, req)
+
+			r := &Response{}
+			err := json.Unmarshal(resp.Body.Bytes(), r)
+			assert.NoError(t, err)
+
+			assert.Equal(t, tc.statusCode, resp.Code)
+			assert.Equal(t, &Response{Message: "nope"}, r)
+		})
+	}
+}
+
 func TestJWTWithConfig_RolesFunc(t *testing.T) {
 	testCases := []struct {
 		name       string
@@ -341,6 +433,51 @@ func TestJWTWithConfig_Enforcer_Panic(t *testing.T) {
 	e := echo.New()
 
 	assert.Panics(t, func() { e.Use(CasbinWithConfig(Config{})) })
+
+	var ce *casbin.Enforcer
+	assert.Panics(t, func() { e.Use(Casbin(ce)) })
+}
+
+func TestJWTWithConfig_SyncedEnforcer(t *testing.T) {
+	se, err := casbin.NewSyncedEnforcer("./fixtures/model.conf", "./fixtures/policy.csv")
+	if err != nil {
+		assert.NoError(t, err)
+	}
+
+	testCases := []struct {
+		name       string
+		roles      string
+		endpoint   string
+		statusCode int
+	}{
+		{"user user", "user", "/user", http.StatusOK},
+		{"user admin", "user", "/admin", http.StatusForbidden},
+		{"admin admin", "admin", "/admin", http.StatusOK},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+
+			e.GET(tc.endpoint, func(c echo.Context) error {
+				return c.JSON(http.StatusOK, "ok")
+			})
+
+			config := Config{
+				Enforcer:          se,
+				EnableRolesHeader: true,
+			}
+			e.Use(CasbinWithConfig(config))
+
+			req := httptest.NewRequest(http.MethodGet, tc.endpoint, nil)
+			req.Header.Add("X-Roles", tc.roles)
+			resp := httptest.NewRecorder()
+
+			e.ServeHTTP(resp, req)
+
+			assert.Equal(t, tc.statusCode, resp.Code)
+		})
+	}
 }
 
 func TestJWTWithConfig_Functions(t *testing.T) {
@@ -397,3 +534,3676 @@ func TestJWTWithConfig_Skipper(t *testing.T) {
 
 	assert.Equal(t, http.StatusOK, resp.Code)
 }
+
+func TestJWTWithConfig_NormalizeSubject(t *testing.T) {
+	testCases := []struct {
+		name       string
+		source     string
+		subject    string
+		normalize  func(string) string
+		statusCode int
+	}{
+		{"func", "func", "Alice@Example.COM", strings.ToLower, http.StatusOK},
+		{"subject func", "subject", "Alice@Example.com", strings.ToLower, http.StatusOK},
+		{"subject func not normalized", "subject", "Alice@Example.com", nil, http.StatusForbidden},
+		{"context", "context", "ALICE@example.com", strings.ToLower, http.StatusOK},
+		{"header", "header", "alice@EXAMPLE.com", strings.ToLower, http.StatusOK},
+		{"not normalized", "header", "Alice@Example.com", nil, http.StatusForbidden},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+
+			e.GET("/alice", func(c echo.Context) error {
+				return c.JSON(http.StatusOK, "ok")
+			})
+
+			config := Config{
+				Enforcer:          enforcer,
+				EnableRolesHeader: true,
+				NormalizeSubject:  tc.normalize,
+			}
+			if tc.source == "func" {
+				config.RolesFunc = func(c echo.Context) ([]string, error) {
+					return []string{tc.subject}, nil
+				}
+			}
+			if tc.source == "subject" {
+				config.SubjectFunc = func(c echo.Context) (interface{}, error) {
+					return tc.subject, nil
+				}
+			}
+
+			e.Use(
+				func(next echo.HandlerFunc) echo.HandlerFunc {
+					return func(c echo.Context) error {
+						if tc.source == "context" {
+							c.Set("roles", []string{tc.subject})
+						}
+						return next(c)
+					}
+				},
+				CasbinWithConfig(config),
+			)
+
+			req := httptest.NewRequest(http.MethodGet, "/alice", nil)
+			if tc.source == "header" {
+				req.Header.Add("X-Roles", tc.subject)
+			}
+			resp := httptest.NewRecorder()
+
+			e.ServeHTTP(resp, req)
+
+			assert.Equal(t, tc.statusCode, resp.Code)
+		})
+	}
+}
+
+func TestJWTWithConfig_PermittedActions(t *testing.T) {
+	testCases := []struct {
+		name      string
+		roles     string
+		endpoint  string
+		permitted map[string]bool
+	}{
+		{"root any", "any", "/", map[string]bool{"GET": true, "POST": false, "PATCH": false}},
+		{"user user", "user", "/user", map[string]bool{"GET": true, "POST": true, "PATCH": false}},
+		{"admin any admin", "any,admin", "/admin", map[string]bool{"GET": true, "POST": false, "PATCH": false}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+
+			e.GET(tc.endpoint, func(c echo.Context) error {
+				assert.Equal(t, tc.permitted, c.Get("permitted_actions"))
+				return c.JSON(http.StatusOK, "ok")
+			})
+
+			config := Config{
+				Enforcer:          enforcer,
+				EnableRolesHeader: true,
+				PermittedActions:  []string{"GET", "POST", "PATCH"},
+			}
+			e.Use(CasbinWithConfig(config))
+
+			req := httptest.NewRequest(http.MethodGet, tc.endpoint, nil)
+			req.Header.Add("X-Roles", tc.roles)
+			resp := httptest.NewRecorder()
+
+			e.ServeHTTP(resp, req)
+
+			assert.Equal(t, http.StatusOK, resp.Code)
+		})
+	}
+}
+
+func TestJWTWithConfig_ReadOnlyMode(t *testing.T) {
+	testCases := []struct {
+		name       string
+		roles      string
+		method     string
+		statusCode int
+		duration   time.Duration
+		retryAfter string
+	}{
+		{"get allowed", "user", http.MethodGet, http.StatusOK, 2 * time.Minute, ""},
+		{"get denied", "any", http.MethodGet, http.StatusForbidden, 2 * time.Minute, ""},
+		{"post", "user", http.MethodPost, http.StatusServiceUnavailable, 2 * time.Minute, "120"},
+		{"delete", "admin", http.MethodDelete, http.StatusServiceUnavailable, 2 * time.Minute, "120"},
+		{"under a second", "user", http.MethodPost, http.StatusServiceUnavailable, 500 * time.Millisecond, "1"},
+		{"fractional", "user", http.MethodPost, http.StatusServiceUnavailable, 1500 * time.Millisecond, "2"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+
+			e.Any("/user", func(c echo.Context) error {
+				return c.JSON(http.StatusOK, "ok")
+			})
+
+			config := Config{
+				Enforcer:           enforcer,
+				EnableRolesHeader:  true,
+				ReadOnlyMode:       true,
+				MaintenanceMessage: "maintenance",
+				RetryAfter:         tc.duration,
+			}
+			e.Use(CasbinWithConfig(config))
+
+			req := httptest.NewRequest(tc.method, "/user", nil)
+			req.Header.Add("X-Roles", tc.roles)
+			resp := httptest.NewRecorder()
+
+			e.ServeHTTP(resp, req)
+
+			assert.Equal(t, tc.statusCode, resp.Code)
+			assert.Equal(t, tc.retryAfter, resp.Header().Get("Retry-After"))
+			if tc.statusCode == http.StatusServiceUnavailable {
+				r := &Response{}
+				err := json.Unmarshal(resp.Body.Bytes(), r)
+				assert.NoError(t, err)
+				assert.Equal(t, &Response{Message: "maintenance"}, r)
+			}
+		})
+	}
+}
+
+func TestJWTWithConfig_ReadOnlyModeFunc(t *testing.T) {
+	e := echo.New()
+
+	e.Any("/user", func(c echo.Context) error {
+		return c.JSON(http.StatusOK, "ok")
+	})
+
+	var readOnly atomic.Bool
+	config := Config{
+		Enforcer:          enforcer,
+		EnableRolesHeader: true,
+		ReadOnlyModeFunc:  readOnly.Load,
+		NormalizeMethod:   true,
+	}
+	e.Use(CasbinWithConfig(config))
+
+	assert.Equal(t, http.StatusOK, serveMethod(e, http.MethodPost, "user", "/user"))
+
+	readOnly.Store(true)
+	assert.Equal(t, http.StatusServiceUnavailable, serveMethod(e, http.MethodPost, "user", "/user"))
+	assert.Equal(t, http.StatusOK, serveMethod(e, http.MethodGet, "user", "/user"))
+	assert.NotEqual(t, http.StatusServiceUnavailable, serveMethod(e, "get", "user", "/user"))
+
+	readOnly.Store(false)
+	assert.Equal(t, http.StatusOK, serveMethod(e, http.MethodPost, "user", "/user"))
+}
+
+func TestJWTWithConfig_RolesHeader_GRPCGateway(t *testing.T) {
+	testCases := []struct {
+		name       string
+		header     string
+		roles      string
+		statusCode int
+	}{
+		{"admin", "Grpc-Metadata-Roles", "user,admin", http.StatusOK},
+		{"user", "Grpc-Metadata-Roles", "user", http.StatusForbidden},
+		{"unprefixed", "X-Roles", "user,admin", http.StatusForbidden},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+
+			e.GET("/admin", func(c echo.Context) error {
+				return c.JSON(http.StatusOK, "ok")
+			})
+
+			config := Config{
+				Enforcer:          enforcer,
+				EnableRolesHeader: true,
+				RolesHeader:       "Grpc-Metadata-Roles",
+			}
+			e.Use(CasbinWithConfig(config))
+
+			req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+			req.Header.Add(tc.header, tc.roles)
+			resp := httptest.NewRecorder()
+
+			e.ServeHTTP(resp, req)
+
+			assert.Equal(t, tc.statusCode, resp.Code)
+		})
+	}
+}
+
+func TestJWTWithConfig_ObjectsHeader(t *testing.T) {
+	testCases := []struct {
+		name       string
+		roles      string
+		objects    string
+		delimiter  string
+		statusCode int
+		failed     []string
+		allowed    []string
+	}{
+		{"no objects", "any", "", "", http.StatusOK, nil, []string{"/"}},
+		{"user user", "user", "/user", "", http.StatusOK, nil, []string{"/"}},
+		{"user admin", "user", "/user,/admin", "", http.StatusForbidden, []string{"/admin"}, nil},
+		{"any user admin", "any", "/user, /admin", "", http.StatusForbidden, []string{"/user", "/admin"}, nil},
+		{"admin user admin", "admin", "/user,/admin", "", http.StatusOK, nil, []string{"/"}},
+		{"delimiter", "admin", "/user;/admin", ";", http.StatusOK, nil, []string{"/"}},
+		{"empty entries", "user", "/user,,/user", "", http.StatusOK, nil, []string{"/"}},
+		{"trailing delimiter", "user", "/user, ", "", http.StatusOK, nil, []string{"/"}},
+		{"only delimiters", "any", ",,", "", http.StatusOK, nil, []string{"/"}},
+		{"empty entries denied", "user", ",/admin,", "", http.StatusForbidden, []string{"/admin"}, nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+
+			e.GET("/", func(c echo.Context) error {
+				return c.JSON(http.StatusOK, "ok")
+			})
+
+			var failed, succeeded, allowed []string
+			config := Config{
+				Enforcer:               enforcer,
+				EnableRolesHeader:      true,
+				EnableObjectsHeader:    true,
+				ObjectsHeaderDelimiter: tc.delimiter,
+				FailureFunc: func(roles []string, obj string, act string) {
+					failed = append(failed, obj)
+				},
+				SuccessFunc: func(role string, obj string, act string) {
+					succeeded = append(succeeded, obj)
+				},
+				OnAllow: func(c echo.Context, role string, roles []string, obj string, act string) {
+					allowed = append(allowed, obj)
+				},
+			}
+			e.Use(CasbinWithConfig(config))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Add("X-Roles", tc.roles)
+			req.Header.Add("X-Target-Objects", tc.objects)
+			resp := httptest.NewRecorder()
+
+			e.ServeHTTP(resp, req)
+
+			assert.Equal(t, tc.statusCode, resp.Code)
+			assert.Equal(t, tc.failed, failed)
+			assert.Equal(t, tc.allowed, succeeded)
+			assert.Equal(t, tc.allowed, allowed)
+		})
+	}
+}
+
+func TestJWTWithConfig_DecisionTrailer(t *testing.T) {
+	testCases := []struct {
+		name    string
+		enabled bool
+		trailer http.Header
+	}{
+		{"enabled", true, http.Header{"X-Authorization-Decision": []string{"allowed"}}},
+		{"disabled", false, nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+
+			e.GET("/", func(c echo.Context) error {
+				return c.Stream(http.StatusOK, echo.MIMETextPlain, strings.NewReader("ok"))
+			})
+
+			config := Config{
+				Enforcer:              enforcer,
+				EnableDecisionTrailer: tc.enabled,
+			}
+			e.Use(CasbinWithConfig(config))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			resp := httptest.NewRecorder()
+
+			e.ServeHTTP(resp, req)
+
+			assert.Equal(t, http.StatusOK, resp.Code)
+			assert.Equal(t, tc.trailer, resp.Result().Trailer)
+		})
+	}
+}
+
+type groupProvider map[string][]string
+
+func (p groupProvider) GroupsFor(ctx context.Context, subject string) ([]string, error) {
+	if subject == "error" {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError)
+	}
+	return p[subject], nil
+}
+
+func TestJWTWithConfig_GroupProvider(t *testing.T) {
+	testCases := []struct {
+		name       string
+		subject    any
+		roles      string
+		statusCode int
+	}{
+		{"admin", "alice@example.com", "", http.StatusOK},
+		{"normalized", "Alice@Example.com", "", http.StatusOK},
+		{"user", "bob@example.com", "", http.StatusForbidden},
+		{"ignores header", "bob@example.com", "admin", http.StatusForbidden},
+		{"unknown", "eve@example.com", "", http.StatusForbidden},
+		{"no subject", nil, "admin", http.StatusForbidden},
+		{"error", "error", "", http.StatusInternalServerError},
+	}
+
+	provider := groupProvider{
+		"alice@example.com": {"admin"},
+		"bob@example.com":   {"user"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+
+			e.GET("/admin", func(c echo.Context) error {
+				return c.JSON(http.StatusOK, "ok")
+			})
+
+			config := Config{
+				Enforcer:          enforcer,
+				EnableRolesHeader: true,
+				GroupProvider:     provider,
+				NormalizeSubject:  strings.ToLower,
+			}
+
+			e.Use(
+				func(next echo.HandlerFunc) echo.HandlerFunc {
+					return func(c echo.Context) error {
+						c.Set("subject", tc.subject)
+						return next(c)
+					}
+				},
+				CasbinWithConfig(config),
+			)
+
+			req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+			req.Header.Add("X-Roles", tc.roles)
+			resp := httptest.NewRecorder()
+
+			e.ServeHTTP(resp, req)
+
+			assert.Equal(t, tc.statusCode, resp.Code)
+		})
+	}
+}
+
+type countingGroupProvider struct {
+	groupProvider
+	count atomic.Int64
+}
+
+func (p *countingGroupProvider) GroupsFor(ctx context.Context, subject string) ([]string, error) {
+	p.count.Add(1)
+	return p.groupProvider.GroupsFor(ctx, subject)
+}
+
+func TestJWTWithConfig_GroupProviderCache(t *testing.T) {
+	testCases := []struct {
+		name       string
+		subject    string
+		ttl        time.Duration
+		statusCode int
+		count      int64
+		errors     []string
+	}{
+		{"cached", "alice@example.com", time.Minute, http.StatusOK, 1, nil},
+		{"not cached", "alice@example.com", 0, http.StatusOK, 3, nil},
+		{"expired", "alice@example.com", time.Nanosecond, http.StatusOK, 3, nil},
+		{
+			"error not cached", "error", time.Minute, http.StatusInternalServerError, 3,
+			[]string{"error /admin GET", "error /admin GET", "error /admin GET"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+
+			e.GET("/admin", func(c echo.Context) error {
+				// Modifying the roles must not modify the cached roles.
+				c.Get("resolved_roles").([]string)[0] = "user"
+				return c.JSON(http.StatusOK, "ok")
+			})
+
+			var errs []string
+			provider := &countingGroupProvider{groupProvider: groupProvider{"alice@example.com": {"admin"}}}
+			config := Config{
+				Enforcer:      enforcer,
+				GroupProvider: provider,
+				CacheTTL:      tc.ttl,
+				OnEnforceError: func(c echo.Context, role string, obj string, act string, err error) {
+					errs = append(errs, fmt.Sprintf("%s %s %s", role, obj, act))
+				},
+			}
+
+			e.Use(
+				func(next echo.HandlerFunc) echo.HandlerFunc {
+					return func(c echo.Context) error {
+						c.Set("subject", tc.subject)
+						return next(c)
+					}
+				},
+				CasbinWithConfig(config),
+			)
+
+			for i := 0; i < 3; i++ {
+				assert.Equal(t, tc.statusCode, serve(e, "", "/admin"))
+			}
+			assert.Equal(t, tc.count, provider.count.Load())
+			assert.Equal(t, tc.errors, errs)
+		})
+	}
+}
+
+func TestJWTWithConfig_Capabilities(t *testing.T) {
+	testCases := []struct {
+		name         string
+		roles        string
+		enableHeader bool
+		caps         map[string]map[string]bool
+		header       string
+	}{
+		{
+			"any", "any", false,
+			map[string]map[string]bool{"/user": {"GET": false, "POST": false}, "/admin": {"GET": false}},
+			"",
+		},
+		{
+			"user", "user", true,
+			map[string]map[string]bool{"/user": {"GET": true, "POST": true}, "/admin": {"GET": false}},
+			`{"/admin":{"GET":false},"/user":{"GET":true,"POST":true}}`,
+		},
+		{
+			"user admin", "user,admin", true,
+			map[string]map[string]bool{"/user": {"GET": true, "POST": true}, "/admin": {"GET": true}},
+			`{"/admin":{"GET":true},"/user":{"GET":true,"POST":true}}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+
+			e.GET("/", func(c echo.Context) error {
+				assert.Equal(t, tc.caps, c.Get("capabilities"))
+				return c.JSON(http.StatusOK, "ok")
+			})
+
+			config := Config{
+				Enforcer:          enforcer,
+				EnableRolesHeader: true,
+				Capabilities: map[string][]string{
+					"/user":  {"GET", "POST"},
+					"/admin": {"GET"},
+				},
+				EnableCapabilitiesHeader: tc.enableHeader,
+			}
+			e.Use(CasbinWithConfig(config))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Add("X-Roles", tc.roles)
+			resp := httptest.NewRecorder()
+
+			e.ServeHTTP(resp, req)
+
+			assert.Equal(t, http.StatusOK, resp.Code)
+			assert.Equal(t, tc.header, resp.Header().Get("X-Capabilities"))
+		})
+	}
+}
+
+func TestJWTWithConfig_NormalizeObject(t *testing.T) {
+	normalize := func(s string) string {
+		u, err := url.PathUnescape(strings.TrimSpace(s))
+		if err != nil {
+			return s
+		}
+		return strings.ToLower(u)
+	}
+
+	testCases := []struct {
+		name       string
+		endpoint   string
+		objects    string
+		normalize  func(string) string
+		statusCode int
+	}{
+		{"path", "/USER", "", normalize, http.StatusOK},
+		{"path not normalized", "/USER", "", nil, http.StatusForbidden},
+		{"header", "/", " /%55ser ", normalize, http.StatusOK},
+		{"header not normalized", "/", " /%55ser ", nil, http.StatusForbidden},
+		{"path and header", "/User", "/ADMIN", normalize, http.StatusForbidden},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+
+			e.GET(tc.endpoint, func(c echo.Context) error {
+				return c.JSON(http.StatusOK, "ok")
+			})
+
+			config := Config{
+				Enforcer:            enforcer,
+				EnableRolesHeader:   true,
+				EnableObjectsHeader: true,
+				NormalizeObject:     tc.normalize,
+			}
+			e.Use(CasbinWithConfig(config))
+
+			req := httptest.NewRequest(http.MethodGet, tc.endpoint, nil)
+			req.Header.Add("X-Roles", "user")
+			req.Header.Add("X-Target-Objects", tc.objects)
+			resp := httptest.NewRecorder()
+
+			e.ServeHTTP(resp, req)
+
+			assert.Equal(t, tc.statusCode, resp.Code)
+		})
+	}
+}
+
+func TestJWTWithConfig_DomainFunc(t *testing.T) {
+	de, err := casbin.NewEnforcer("./fixtures/model_domains.conf", "./fixtures/policy_domains.csv")
+	if err != nil {
+		assert.NoError(t, err)
+	}
+
+	testCases := []struct {
+		name       string
+		roles      string
+		domain     string
+		endpoint   string
+		statusCode int
+	}{
+		{"tenant1 user user", "user", "tenant1", "/user", http.StatusOK},
+		{"tenant1 user admin", "user", "tenant1", "/admin", http.StatusForbidden},
+		{"tenant1 admin user", "admin", "tenant1", "/user", http.StatusOK},
+		{"tenant1 admin admin", "admin", "tenant1", "/admin", http.StatusOK},
+		{"tenant2 user user", "user", "tenant2", "/user", http.StatusForbidden},
+		{"tenant2 admin user", "admin", "tenant2", "/user", http.StatusOK},
+		{"tenant2 admin admin", "admin", "tenant2", "/admin", http.StatusForbidden},
+		{"error", "admin", "", "/user", http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+
+			e.GET(tc.endpoint, func(c echo.Context) error {
+				return c.JSON(http.StatusOK, "ok")
+			})
+
+			config := Config{
+				Enforcer:          de,
+				EnableRolesHeader: true,
+				DomainFunc: func(c echo.Context) (string, error) {
+					tenant := c.Request().Header.Get("X-Tenant")
+					if tenant == "" {
+						return "", echo.NewHTTPError(http.StatusBadRequest)
+					}
+					return tenant, nil
+				},
+			}
+			e.Use(CasbinWithConfig(config))
+
+			req := httptest.NewRequest(http.MethodGet, tc.endpoint, nil)
+			req.Header.Add("X-Roles", tc.roles)
+			req.Header.Add("X-Tenant", tc.domain)
+			resp := httptest.NewRecorder()
+
+			e.ServeHTTP(resp, req)
+
+			assert.Equal(t, tc.statusCode, resp.Code)
+		})
+	}
+}
+
+func TestJWTWithConfig_ObjectFunc(t *testing.T) {
+	testCases := []struct {
+		name       string
+		roles      string
+		fn         func(echo.Context) (string, error)
+		statusCode int
+		obj        string
+	}{
+		{"default", "user", nil, http.StatusForbidden, "/users/:id"},
+		{"user", "user", func(c echo.Context) (string, error) { return "/user", nil }, http.StatusOK, "/user"},
+		{"admin", "user", func(c echo.Context) (string, error) { return "/admin", nil }, http.StatusForbidden, "/admin"},
+		{"param", "alice@example.com", func(c echo.Context) (string, error) { return "/" + c.Param("id"), nil }, http.StatusOK, "/alice"},
+		{"error", "user", func(c echo.Context) (string, error) { return "", echo.NewHTTPError(http.StatusNotFound) }, http.StatusNotFound, ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+
+			e.GET("/users/:id", func(c echo.Context) error {
+				return c.JSON(http.StatusOK, "ok")
+			})
+
+			var obj string
+			config := Config{
+				Enforcer:          enforcer,
+				EnableRolesHeader: true,
+				ObjectFunc:        tc.fn,
+				SuccessFunc: func(role string, o string, act string) {
+					obj = o
+				},
+				FailureFunc: func(roles []string, o string, act string) {
+					obj = o
+				},
+			}
+			e.Use(CasbinWithConfig(config))
+
+			req := httptest.NewRequest(http.MethodGet, "/users/alice", nil)
+			req.Header.Add("X-Roles", tc.roles)
+			resp := httptest.NewRecorder()
+
+			e.ServeHTTP(resp, req)
+
+			assert.Equal(t, tc.statusCode, resp.Code)
+			assert.Equal(t, tc.obj, obj)
+		})
+	}
+}
+
+func TestJWTWithConfig_ActionFunc(t *testing.T) {
+	actions := map[string]string{
+		http.MethodGet:    "read",
+		http.MethodPost:   "write",
+		http.MethodDelete: "delete",
+	}
+
+	testCases := []struct {
+		name       string
+		roles      string
+		method     string
+		fn         func(echo.Context) (string, error)
+		statusCode int
+		act        string
+	}{
+		{"default", "user", http.MethodPost, nil, http.StatusOK, http.MethodPost},
+		{"mapped", "user", http.MethodPost, func(c echo.Context) (string, error) {
+			return actions[c.Request().Method], nil
+		}, http.StatusForbidden, "write"},
+		{"search", "user", http.MethodPost, func(c echo.Context) (string, error) {
+			return http.MethodGet, nil
+		}, http.StatusOK, http.MethodGet},
+		{"error", "user", http.MethodPost, func(c echo.Context) (string, error) {
+			return "", echo.NewHTTPError(http.StatusMethodNotAllowed)
+		}, http.StatusMethodNotAllowed, ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+
+			e.Any("/user", func(c echo.Context) error {
+				return c.JSON(http.StatusOK, "ok")
+			})
+
+			var act string
+			config := Config{
+				Enforcer:          enforcer,
+				EnableRolesHeader: true,
+				ActionFunc:        tc.fn,
+				SuccessFunc: func(role string, obj string, a string) {
+					act = a
+				},
+				FailureFunc: func(roles []string, obj string, a string) {
+					act = a
+				},
+			}
+			e.Use(CasbinWithConfig(config))
+
+			req := httptest.NewRequest(tc.method, "/user", nil)
+			req.Header.Add("X-Roles", tc.roles)
+			resp := httptest.NewRecorder()
+
+			e.ServeHTTP(resp, req)
+
+			assert.Equal(t, tc.statusCode, resp.Code)
+			assert.Equal(t, tc.act, act)
+		})
+	}
+}
+
+func TestJWTWithConfig_ErrorHandler(t *testing.T) {
+	testCases := []struct {
+		name       string
+		endpoint   string
+		handler    func(c echo.Context, roles []string, obj string, act string) error
+		statusCode int
+		body       string
+	}{
+		{"success", "/", func(c echo.Context, roles []string, obj string, act string) error {
+			return c.String(http.StatusTeapot, "nope")
+		}, http.StatusOK, "\"ok\"\n"},
+		{"response", "/admin", func(c echo.Context, roles []string, obj string, act string) error {
+			return c.JSON(http.StatusForbidden, map[string]string{"error": "forbidden", "object": obj, "action": act})
+		}, http.StatusForbidden, "{\"action\":\"GET\",\"error\":\"forbidden\",\"object\":\"/admin\"}\n"},
+		{"redirect", "/admin", func(c echo.Context, roles []string, obj string, act string) error {
+			return c.Redirect(http.StatusFound, "/login")
+		}, http.StatusFound, ""},
+		{"error", "/admin", func(c echo.Context, roles []string, obj string, act string) error {
+			return echo.NewHTTPError(http.StatusNotFound, "not found")
+		}, http.StatusNotFound, "{\"message\":\"not found\"}\n"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+
+			e.GET(tc.endpoint, func(c echo.Context) error {
+				return c.JSON(http.StatusOK, "ok")
+			})
+
+			var failed bool
+			config := Config{
+				Enforcer:     enforcer,
+				ErrorHandler: tc.handler,
+				FailureFunc: func([]string, string, string) {
+					failed = true
+				},
+			}
+			e.Use(CasbinWithConfig(config))
+
+			req := httptest.NewRequest(http.MethodGet, tc.endpoint, nil)
+			resp := httptest.NewRecorder()
+
+			e.ServeHTTP(resp, req)
+
+			assert.Equal(t, tc.statusCode, resp.Code)
+			assert.Equal(t, tc.body, resp.Body.String())
+			assert.Equal(t, tc.statusCode != http.StatusOK, failed)
+		})
+	}
+}
+
+func TestJWTWithConfig_ForbiddenMessage_Accept(t *testing.T) {
+	testCases := []struct {
+		name        string
+		accept      string
+		contentType string
+		body        string
+	}{
+		{"absent", "", echo.MIMEApplicationJSONCharsetUTF8, "{\"message\":\"nope\"}\n"},
+		{"any", "*/*", echo.MIMEApplicationJSONCharsetUTF8, "{\"message\":\"nope\"}\n"},
+		{"json", "application/json", echo.MIMEApplicationJSONCharsetUTF8, "{\"message\":\"nope\"}\n"},
+		{"text", "text/plain", echo.MIMETextPlainCharsetUTF8, "nope"},
+		{"text first", "text/plain, application/json", echo.MIMETextPlainCharsetUTF8, "nope"},
+		{"text lower quality", "text/plain;q=0.1, application/json", echo.MIMEApplicationJSONCharsetUTF8, "{\"message\":\"nope\"}\n"},
+		{"json lower quality", "application/json;q=0.5, text/plain", echo.MIMETextPlainCharsetUTF8, "nope"},
+		{"text higher than any", "text/*;q=0.9, */*;q=0.1", echo.MIMETextPlainCharsetUTF8, "nope"},
+		{"text excluded", "text/plain;q=0, */*", echo.MIMEApplicationJSONCharsetUTF8, "{\"message\":\"nope\"}\n"},
+		{"equal quality", "application/json;q=0.5, text/plain;q=0.5", echo.MIMEApplicationJSONCharsetUTF8, "{\"message\":\"nope\"}\n"},
+		{"json first", "application/json, text/plain", echo.MIMEApplicationJSONCharsetUTF8, "{\"message\":\"nope\"}\n"},
+		{"html", "text/html, */*;q=0.8", echo.MIMEApplicationJSONCharsetUTF8, "{\"message\":\"nope\"}\n"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+
+			e.GET("/user", func(c echo.Context) error {
+				return c.JSON(http.StatusOK, "ok")
+			})
+
+			config := Config{
+				Enforcer:         enforcer,
+				ForbiddenMessage: "nope",
+			}
+			e.Use(CasbinWithConfig(config))
+
+			req := httptest.NewRequest(http.MethodGet, "/user", nil)
+			req.Header.Add("Accept", tc.accept)
+			resp := httptest.NewRecorder()
+
+			e.ServeHTTP(resp, req)
+
+			assert.Equal(t, http.StatusForbidden, resp.Code)
+			assert.Equal(t, tc.contentType, resp.Header().Get("Content-Type"))
+			assert.Equal(t, tc.body, resp.Body.String())
+		})
+	}
+}
+
+func TestJWTWithConfig_ForbiddenMessage_AcceptError(t *testing.T) {
+	testCases := []struct {
+		name   string
+		accept string
+	}{
+		{"json", echo.MIMEApplicationJSON},
+		{"text", echo.MIMETextPlain},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+
+			e.GET("/user", func(c echo.Context) error {
+				return c.JSON(http.StatusOK, "ok")
+			})
+
+			var handled []error
+			e.HTTPErrorHandler = func(err error, c echo.Context) {
+				handled = append(handled, err)
+				e.DefaultHTTPErrorHandler(err, c)
+			}
+
+			var returned error
+			e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+				return func(c echo.Context) error {
+					returned = next(c)
+					return returned
+				}
+			})
+			e.Use(CasbinWithConfig(Config{Enforcer: enforcer, ForbiddenMessage: "nope"}))
+
+			req := httptest.NewRequest(http.MethodGet, "/user", nil)
+			req.Header.Add(echo.HeaderAccept, tc.accept)
+			resp := httptest.NewRecorder()
+
+			e.ServeHTTP(resp, req)
+
+			assert.Equal(t, http.StatusForbidden, resp.Code)
+			assert.Equal(t, echo.NewHTTPError(http.StatusForbidden, "nope"), returned)
+			assert.Equal(t, []error{returned}, handled)
+		})
+	}
+}
+
+func TestJWTWithConfig_EnableExplain(t *testing.T) {
+	testCases := []struct {
+		name       string
+		roles      string
+		endpoint   string
+		enabled    bool
+		statusCode int
+		rule       any
+		explained  [][]string
+	}{
+		{"admin", "admin", "/admin", true, http.StatusOK, []string{"admin", "/admin", "GET"}, [][]string{{"admin", "/admin", "GET"}}},
+		{"user admin", "any,user,admin", "/user", true, http.StatusOK, []string{"user", "/user", "(GET)|(POST)|(PUT)|(DELETE)"}, [][]string{{}, {"user", "/user", "(GET)|(POST)|(PUT)|(DELETE)"}}},
+		{"denied", "user", "/admin", true, http.StatusForbidden, nil, [][]string{{}}},
+		{"disabled", "admin", "/admin", false, http.StatusOK, nil, nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+
+			e.GET(tc.endpoint, func(c echo.Context) error {
+				assert.Equal(t, tc.rule, c.Get("casbin_matched_policy"))
+				return c.JSON(http.StatusOK, "ok")
+			})
+
+			var explained [][]string
+			config := Config{
+				Enforcer:          enforcer,
+				EnableRolesHeader: true,
+				EnableExplain:     tc.enabled,
+				ExplainFunc: func(allowed bool, role string, rule []string, obj string, act string) {
+					explained = append(explained, rule)
+				},
+			}
+			e.Use(CasbinWithConfig(config))
+
+			req := httptest.NewRequest(http.MethodGet, tc.endpoint, nil)
+			req.Header.Add("X-Roles", tc.roles)
+			resp := httptest.NewRecorder()
+
+			e.ServeHTTP(resp, req)
+
+			assert.Equal(t, tc.statusCode, resp.Code)
+			assert.Equal(t, tc.explained, explained)
+		})
+	}
+}
+
+type slowEnforcer struct {
+	*casbin.Enforcer
+	delay time.Duration
+}
+
+func (e *slowEnforcer) Enforce(rvals ...interface{}) (bool, error) {
+	time.Sleep(e.delay)
+	return e.Enforcer.Enforce(rvals...)
+}
+
+func TestJWTWithConfig_EnforceTimeout(t *testing.T) {
+	testCases := []struct {
+		name       string
+		roles      string
+		endpoint   string
+		delay      time.Duration
+		timeout    time.Duration
+		statusCode int
+	}{
+		{"no timeout", "user", "/user", 10 * time.Millisecond, 0, http.StatusOK},
+		{"allowed", "user", "/user", 0, time.Second, http.StatusOK},
+		{"denied", "user", "/admin", 0, time.Second, http.StatusForbidden},
+		{"expired", "user", "/user", 100 * time.Millisecond, 10 * time.Millisecond, http.StatusServiceUnavailable},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+
+			e.GET(tc.endpoint, func(c echo.Context) error {
+				return c.JSON(http.StatusOK, "ok")
+			})
+
+			config := Config{
+				Enforcer:          &slowEnforcer{Enforcer: enforcer, delay: tc.delay},
+				EnableRolesHeader: true,
+				EnforceTimeout:    tc.timeout,
+			}
+			e.Use(CasbinWithConfig(config))
+
+			req := httptest.NewRequest(http.MethodGet, tc.endpoint, nil)
+			req.Header.Add("X-Roles", tc.roles)
+			resp := httptest.NewRecorder()
+
+			e.ServeHTTP(resp, req)
+
+			assert.Equal(t, tc.statusCode, resp.Code)
+		})
+	}
+}
+
+type slowCountingEnforcer struct {
+	*casbin.Enforcer
+	delay time.Duration
+	count atomic.Int64
+}
+
+func (e *slowCountingEnforcer) Enforce(rvals ...interface{}) (bool, error) {
+	e.count.Add(1)
+	time.Sleep(e.delay)
+	return e.Enforcer.Enforce(rvals...)
+}
+
+func TestJWTWithConfig_EnforceTimeoutHooks(t *testing.T) {
+	testCases := []struct {
+		name       string
+		roles      string
+		delay      time.Duration
+		timeout    time.Duration
+		statusCode int
+		calls      int64
+		hooks      []string
+	}{
+		{"completed", "any,user", 0, time.Second, http.StatusOK, 2, []string{"before any", "before user", "success user", "allow any,user"}},
+		{"expired", "admin,manager,auditor,user", 40 * time.Millisecond, 10 * time.Millisecond, http.StatusServiceUnavailable, 1, []string{"before admin", "before manager", "before auditor", "before user"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+
+			e.GET("/user", func(c echo.Context) error {
+				return c.JSON(http.StatusOK, "ok")
+			})
+
+			var (
+				mu    sync.Mutex
+				hooks []string
+			)
+			record := func(hook string) {
+				mu.Lock()
+				defer mu.Unlock()
+				hooks = append(hooks, hook)
+			}
+
+			se := &slowCountingEnforcer{Enforcer: enforcer, delay: tc.delay}
+			config := Config{
+				Enforcer:          se,
+				EnableRolesHeader: true,
+				EnforceTimeout:    tc.timeout,
+				BeforeEnforce: func(c echo.Context, role string, obj string, act string) (string, string, string, error) {
+					record("before " + role)
+					return role, obj, act, nil
+				},
+				SuccessFunc: func(role string, obj string, act string) {
+					record("success " + role)
+				},
+				OnAllow: func(c echo.Context, matchedRole string, roles []string, obj string, act string) {
+					record("allow " + c.Request().Header.Get("X-Roles"))
+				},
+			}
+			e.Use(CasbinWithConfig(config))
+
+			assert.Equal(t, tc.statusCode, serve(e, tc.roles, "/user"))
+
+			// Give the goroutine time to complete if it wasn't stopped.
+			time.Sleep(100 * time.Millisecond)
+
+			mu.Lock()
+			defer mu.Unlock()
+			assert.Equal(t, tc.calls, se.count.Load())
+			assert.Equal(t, tc.hooks, hooks)
+		})
+	}
+}
+
+type countingEnforcer struct {
+	*casbin.Enforcer
+	count atomic.Int64
+}
+
+func (e *countingEnforcer) Enforce(rvals ...interface{}) (bool, error) {
+	e.count.Add(1)
+	return e.Enforcer.Enforce(rvals...)
+}
+
+func TestJWTWithConfig_CacheTTL(t *testing.T) {
+	testCases := []struct {
+		name     string
+		ttl      time.Duration
+		roles    string
+		endpoint string
+		count    int64
+	}{
+		{"disabled", 0, "any,user", "/user", 6},
+		{"allowed", time.Minute, "any,user", "/user", 2},
+		{"denied", time.Minute, "user", "/admin", 1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+
+			e.GET(tc.endpoint, func(c echo.Context) error {
+				return c.JSON(http.StatusOK, "ok")
+			})
+
+			ce := &countingEnforcer{Enforcer: enforcer}
+			config := Config{
+				Enforcer:          ce,
+				EnableRolesHeader: true,
+				CacheTTL:          tc.ttl,
+			}
+			e.Use(CasbinWithConfig(config))
+
+			var codes []int
+			for i := 0; i < 3; i++ {
+				req := httptest.NewRequest(http.MethodGet, tc.endpoint, nil)
+				req.Header.Add("X-Roles", tc.roles)
+				resp := httptest.NewRecorder()
+
+				e.ServeHTTP(resp, req)
+
+				codes = append(codes, resp.Code)
+			}
+
+			assert.Equal(t, codes[0], codes[1])
+			assert.Equal(t, codes[0], codes[2])
+			assert.Equal(t, tc.count, ce.count.Load())
+		})
+	}
+}
+
+type metricsCollector struct {
+	allowed map[string]int
+	denied  map[string]int
+}
+
+func (m *metricsCollector) IncAllowed(role string, obj string, act string) {
+	m.allowed[role+" "+obj+" "+act]++
+}
+
+func (m *metricsCollector) IncDenied(roles []string, obj string, act string) {
+	m.denied[strings.Join(roles, ",")+" "+obj+" "+act]++
+}
+
+func TestJWTWithConfig_MetricsCollector(t *testing.T) {
+	e := echo.New()
+
+	e.Any("/*", func(c echo.Context) error {
+		return c.JSON(http.StatusOK, "ok")
+	})
+
+	m := &metricsCollector{allowed: map[string]int{}, denied: map[string]int{}}
+	config := Config{
+		Enforcer:          enforcer,
+		EnableRolesHeader: true,
+		ObjectFunc: func(c echo.Context) (string, error) {
+			return c.Request().URL.Path, nil
+		},
+		MetricsCollector: m,
+	}
+	e.Use(CasbinWithConfig(config))
+
+	requests := []struct {
+		roles    string
+		endpoint string
+		method   string
+	}{
+		{"any", "/", http.MethodGet},
+		{"any", "/", http.MethodGet},
+		{"any,user", "/user", http.MethodPost},
+		{"user", "/admin", http.MethodGet},
+		{"user", "/admin", http.MethodGet},
+		{"user", "/admin", http.MethodGet},
+		{"admin", "/admin", http.MethodGet},
+		{"any", "/user", http.MethodDelete},
+	}
+
+	for _, r := range requests {
+		req := httptest.NewRequest(r.method, r.endpoint, nil)
+		req.Header.Add("X-Roles", r.roles)
+		resp := httptest.NewRecorder()
+
+		e.ServeHTTP(resp, req)
+	}
+
+	assert.Equal(t, map[string]int{
+		"any / GET":        2,
+		"user /user POST":  1,
+		"admin /admin GET": 1,
+	}, m.allowed)
+	assert.Equal(t, map[string]int{
+		"user /admin GET":  3,
+		"any /user DELETE": 1,
+	}, m.denied)
+}
+
+func TestJWTWithConfig_OnDecision(t *testing.T) {
+	testCases := []struct {
+		name       string
+		roles      string
+		endpoint   string
+		statusCode int
+		allowed    bool
+		obj        string
+	}{
+		{"allowed", "user", "/user", http.StatusOK, true, "/user"},
+		{"denied", "user", "/admin", http.StatusForbidden, false, "/admin"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+
+			e.GET(tc.endpoint, func(c echo.Context) error {
+				return c.JSON(http.StatusOK, "ok")
+			})
+
+			var (
+				calls     []string
+				requestID string
+				allowed   bool
+				obj       string
+			)
+			config := Config{
+				Enforcer:          enforcer,
+				EnableRolesHeader: true,
+				OnDecision: func(c echo.Context, a bool, roles []string, o string, act string) {
+					calls = append(calls, "decision")
+					requestID = c.Request().Header.Get(echo.HeaderXRequestID)
+					allowed = a
+					obj = o
+				},
+				SuccessFunc: func(string, string, string) {
+					calls = append(calls, "success")
+				},
+				FailureFunc: func([]string, string, string) {
+					calls = append(calls, "failure")
+				},
+			}
+			e.Use(CasbinWithConfig(config))
+
+			req := httptest.NewRequest(http.MethodGet, tc.endpoint, nil)
+			req.Header.Add("X-Roles", tc.roles)
+			req.Header.Add(echo.HeaderXRequestID, "abc")
+			resp := httptest.NewRecorder()
+
+			e.ServeHTTP(resp, req)
+
+			assert.Equal(t, tc.statusCode, resp.Code)
+			assert.Equal(t, "abc", requestID)
+			assert.Equal(t, tc.allowed, allowed)
+			assert.Equal(t, tc.obj, obj)
+			if tc.allowed {
+				assert.Equal(t, []string{"success", "decision"}, calls)
+			} else {
+				assert.Equal(t, []string{"decision", "failure"}, calls)
+			}
+		})
+	}
+}
+
+func TestJWTWithConfig_TrimPrefix(t *testing.T) {
+	testCases := []struct {
+		name       string
+		prefix     string
+		endpoint   string
+		statusCode int
+		obj        string
+	}{
+		{"matching", "/api/v1", "/api/v1/user", http.StatusOK, "/user"},
+		{"matching trailing slash", "/api/v1/", "/api/v1/user", http.StatusOK, "/user"},
+		{"root", "/api/v1", "/api/v1", http.StatusOK, "/"},
+		{"non-matching", "/api/v1", "/api/v2/user", http.StatusForbidden, "/api/v2/user"},
+		{"partial segment", "/api/v1", "/api/v1user", http.StatusForbidden, "/api/v1user"},
+		{"not a prefix", "/user", "/users/user", http.StatusForbidden, "/users/user"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+
+			e.GET(tc.endpoint, func(c echo.Context) error {
+				return c.JSON(http.StatusOK, "ok")
+			})
+
+			var obj string
+			config := Config{
+				Enforcer:          enforcer,
+				EnableRolesHeader: true,
+				TrimPrefix:        tc.prefix,
+				SuccessFunc: func(role string, o string, act string) {
+					obj = o
+				},
+				FailureFunc: func(roles []string, o string, act string) {
+					obj = o
+				},
+			}
+			e.Use(CasbinWithConfig(config))
+
+			req := httptest.NewRequest(http.MethodGet, tc.endpoint, nil)
+			req.Header.Add("X-Roles", "user")
+			resp := httptest.NewRecorder()
+
+			e.ServeHTTP(resp, req)
+
+			assert.Equal(t, tc.statusCode, resp.Code)
+			assert.Equal(t, tc.obj, obj)
+		})
+	}
+}
+
+func TestJWTWithConfig_UseRequestURI(t *testing.T) {
+	testCases := []struct {
+		name       string
+		enabled    bool
+		uri        string
+		statusCode int
+		obj        string
+	}{
+		{"disabled", false, "/users/alice", http.StatusForbidden, "/users/:id"},
+		{"enabled", true, "/users/alice", http.StatusOK, "/users/alice"},
+		{"enabled denied", true, "/users/bob", http.StatusForbidden, "/users/bob"},
+		{"query", true, "/users/alice?q=1", http.StatusOK, "/users/alice"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			pe, err := casbin.NewEnforcer("./fixtures/model.conf")
+			assert.NoError(t, err)
+			_, err = pe.AddPolicy("alice@example.com", "/users/alice", "GET")
+			assert.NoError(t, err)
+
+			e := echo.New()
+
+			e.GET("/users/:id", func(c echo.Context) error {
+				return c.JSON(http.StatusOK, "ok")
+			})
+
+			var obj string
+			config := Config{
+				Enforcer:          pe,
+				EnableRolesHeader: true,
+				UseRequestURI:     tc.enabled,
+				SuccessFunc: func(role string, o string, act string) {
+					obj = o
+				},
+				FailureFunc: func(roles []string, o string, act string) {
+					obj = o
+				},
+			}
+			e.Use(CasbinWithConfig(config))
+
+			req := httptest.NewRequest(http.MethodGet, tc.uri, nil)
+			req.Header.Add("X-Roles", "alice@example.com")
+			resp := httptest.NewRecorder()
+
+			e.ServeHTTP(resp, req)
+
+			assert.Equal(t, tc.statusCode, resp.Code)
+			assert.Equal(t, tc.obj, obj)
+		})
+	}
+}
+
+func TestJWTWithConfig_MatchAllRoles(t *testing.T) {
+	testCases := []struct {
+		name       string
+		matchAll   bool
+		roles      string
+		endpoint   string
+		statusCode int
+		succeeded  []string
+	}{
+		{"any any user", false, "any,user", "/user", http.StatusOK, []string{"user"}},
+		{"any user admin", false, "any,user", "/admin", http.StatusForbidden, nil},
+		{"all any user", true, "any,user", "/user", http.StatusForbidden, nil},
+		{"all user admin", true, "user,admin", "/user", http.StatusOK, []string{"user", "admin"}},
+		{"all user admin admin", true, "user,admin", "/admin", http.StatusForbidden, nil},
+		{"all admin", true, "admin", "/admin", http.StatusOK, []string{"admin"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+
+			e.GET(tc.endpoint, func(c echo.Context) error {
+				return c.JSON(http.StatusOK, "ok")
+			})
+
+			var succeeded []string
+			config := Config{
+				Enforcer:          enforcer,
+				EnableRolesHeader: true,
+				MatchAllRoles:     tc.matchAll,
+				SuccessFunc: func(role string, obj string, act string) {
+					succeeded = append(succeeded, role)
+				},
+			}
+			e.Use(CasbinWithConfig(config))
+
+			req := httptest.NewRequest(http.MethodGet, tc.endpoint, nil)
+			req.Header.Add("X-Roles", tc.roles)
+			resp := httptest.NewRecorder()
+
+			e.ServeHTTP(resp, req)
+
+			assert.Equal(t, tc.statusCode, resp.Code)
+			assert.Equal(t, tc.succeeded, succeeded)
+		})
+	}
+}
+
+func TestJWTWithConfig_MatchAllRoles_PermittedActions(t *testing.T) {
+	e := echo.New()
+
+	e.GET("/", func(c echo.Context) error {
+		assert.Equal(t, map[string]bool{"GET": true, "POST": false}, c.Get("permitted_actions"))
+		assert.Equal(t, map[string]map[string]bool{"/user": {"GET": false}}, c.Get("capabilities"))
+		return c.JSON(http.StatusOK, "ok")
+	})
+
+	config := Config{
+		Enforcer:          enforcer,
+		EnableRolesHeader: true,
+		MatchAllRoles:     true,
+		PermittedActions:  []string{"GET", "POST"},
+		Capabilities:      map[string][]string{"/user": {"GET"}},
+	}
+	e.Use(CasbinWithConfig(config))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Add("X-Roles", "any,user")
+	resp := httptest.NewRecorder()
+
+	e.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+}
+
+func TestJWTWithConfig_SkipOptions(t *testing.T) {
+	testCases := []struct {
+		name        string
+		skipOptions bool
+		skipper     middleware.Skipper
+		method      string
+		statusCode  int
+	}{
+		{"options", true, nil, http.MethodOptions, http.StatusOK},
+		{"options disabled", false, nil, http.MethodOptions, http.StatusForbidden},
+		{"get", true, nil, http.MethodGet, http.StatusForbidden},
+		{"skipper", true, func(c echo.Context) bool { return c.Request().Method == http.MethodGet }, http.MethodGet, http.StatusOK},
+		{"skipper options", true, func(c echo.Context) bool { return false }, http.MethodOptions, http.StatusOK},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+
+			e.Any("/user", func(c echo.Context) error {
+				return c.JSON(http.StatusOK, "ok")
+			})
+
+			config := Config{
+				Enforcer:    enforcer,
+				Skipper:     tc.skipper,
+				SkipOptions: tc.skipOptions,
+			}
+			e.Use(CasbinWithConfig(config))
+
+			req := httptest.NewRequest(tc.method, "/user", nil)
+			resp := httptest.NewRecorder()
+
+			e.ServeHTTP(resp, req)
+
+			assert.Equal(t, tc.statusCode, resp.Code)
+		})
+	}
+}
+
+func TestJWTWithConfig_ObjectTemplate(t *testing.T) {
+	testCases := []struct {
+		name     string
+		route    string
+		template string
+		uri      string
+		obj      string
+	}{
+		{"empty", "/users/:id", "", "/users/42", "/users/:id"},
+		{"single param", "/users/:id", "/users/:id", "/users/42", "/users/42"},
+		{"multi param", "/orgs/:org/users/:id", "/orgs/:org/users/:id", "/orgs/acme/users/42", "/orgs/acme/users/42"},
+		{"reordered", "/orgs/:org/users/:id", "/users/:id/:org", "/orgs/acme/users/42", "/users/42/acme"},
+		{"missing param", "/users/:id", "/users/:id/:missing", "/users/42", "/users/42/:missing"},
+		{"no params", "/users/:id", "/users", "/users/42", "/users"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+
+			e.GET(tc.route, func(c echo.Context) error {
+				return c.JSON(http.StatusOK, "ok")
+			})
+
+			var obj string
+			config := Config{
+				Enforcer:       enforcer,
+				ObjectTemplate: tc.template,
+				FailureFunc: func(roles []string, o string, act string) {
+					obj = o
+				},
+			}
+			e.Use(CasbinWithConfig(config))
+
+			req := httptest.NewRequest(http.MethodGet, tc.uri, nil)
+			resp := httptest.NewRecorder()
+
+			e.ServeHTTP(resp, req)
+
+			assert.Equal(t, http.StatusForbidden, resp.Code)
+			assert.Equal(t, tc.obj, obj)
+		})
+	}
+}
+
+func TestJWTWithConfig_NormalizeMethod(t *testing.T) {
+	testCases := []struct {
+		name       string
+		normalize  bool
+		method     string
+		statusCode int
+	}{
+		{"lowercase", true, "get", http.StatusOK},
+		{"mixed case", true, "Get", http.StatusOK},
+		{"uppercase", true, http.MethodGet, http.StatusOK},
+		{"disabled", false, "get", http.StatusForbidden},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+
+			e.Add(tc.method, "/admin", func(c echo.Context) error {
+				return c.JSON(http.StatusOK, "ok")
+			})
+
+			config := Config{
+				Enforcer:          enforcer,
+				EnableRolesHeader: true,
+				NormalizeMethod:   tc.normalize,
+			}
+			e.Use(CasbinWithConfig(config))
+
+			req := httptest.NewRequest(tc.method, "/admin", nil)
+			req.Header.Add("X-Roles", "admin")
+			resp := httptest.NewRecorder()
+
+			e.ServeHTTP(resp, req)
+
+			assert.Equal(t, tc.statusCode, resp.Code)
+		})
+	}
+}
+
+func TestJWTWithConfig_BeforeEnforce(t *testing.T) {
+	testCases := []struct {
+		name       string
+		roles      string
+		endpoint   string
+		fn         func(c echo.Context, role string, obj string, act string) (string, string, string, error)
+		statusCode int
+		result     []string
+	}{
+		{"unchanged", "user", "/health/live", func(c echo.Context, role string, obj string, act string) (string, string, string, error) {
+			return role, obj, act, nil
+		}, http.StatusForbidden, []string{"failure", "user", "/health/live", "GET"}},
+		{"object", "any", "/health/live", func(c echo.Context, role string, obj string, act string) (string, string, string, error) {
+			if strings.HasPrefix(obj, "/health") {
+				obj = "/"
+			}
+			return role, obj, act, nil
+		}, http.StatusOK, []string{"success", "any", "/", "GET"}},
+		{"subject", "guest", "/user", func(c echo.Context, role string, obj string, act string) (string, string, string, error) {
+			return "user", obj, act, nil
+		}, http.StatusOK, []string{"success", "user", "/user", "GET"}},
+		{"action", "user", "/user", func(c echo.Context, role string, obj string, act string) (string, string, string, error) {
+			return role, obj, "read", nil
+		}, http.StatusForbidden, []string{"failure", "user", "/user", "read"}},
+		{"error", "user", "/user", func(c echo.Context, role string, obj string, act string) (string, string, string, error) {
+			return "", "", "", echo.NewHTTPError(http.StatusBadRequest)
+		}, http.StatusBadRequest, nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+
+			e.GET(tc.endpoint, func(c echo.Context) error {
+				return c.JSON(http.StatusOK, "ok")
+			})
+
+			var result []string
+			config := Config{
+				Enforcer:          enforcer,
+				EnableRolesHeader: true,
+				BeforeEnforce:     tc.fn,
+				SuccessFunc: func(role string, obj string, act string) {
+					result = []string{"success", role, obj, act}
+				},
+				FailureFunc: func(roles []string, obj string, act string) {
+					result = []string{"failure", strings.Join(roles, ","), obj, act}
+				},
+			}
+			e.Use(CasbinWithConfig(config))
+
+			req := httptest.NewRequest(http.MethodGet, tc.endpoint, nil)
+			req.Header.Add("X-Roles", tc.roles)
+			resp := httptest.NewRecorder()
+
+			e.ServeHTTP(resp, req)
+
+			assert.Equal(t, tc.statusCode, resp.Code)
+			assert.Equal(t, tc.result, result)
+		})
+	}
+}
+
+func TestJWTWithConfig_BeforeEnforceRewrites(t *testing.T) {
+	testCases := []struct {
+		name       string
+		roles      string
+		batch      bool
+		timeout    time.Duration
+		statusCode int
+		role       string
+		result     []string
+	}{
+		{"enforce", "guest", false, 0, http.StatusOK, "guest", []string{"user", "/user", "GET"}},
+		{"batch", "any,guest", true, 0, http.StatusOK, "guest", []string{"user", "/user", "GET"}},
+		{"timeout", "guest", false, time.Second, http.StatusOK, "guest", []string{"user", "/user", "GET"}},
+		{"not rewritten", "any", false, 0, http.StatusForbidden, "", nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+
+			var role string
+			e.GET("/account", func(c echo.Context) error {
+				role, _ = c.Get("authorized_role").(string)
+				return c.JSON(http.StatusOK, "ok")
+			})
+
+			var result []string
+			config := Config{
+				Enforcer:          enforcer,
+				EnableRolesHeader: true,
+				UseBatchEnforce:   tc.batch,
+				EnforceTimeout:    tc.timeout,
+				NormalizeObject:   strings.ToLower,
+				BeforeEnforce: func(c echo.Context, role string, obj string, act string) (string, string, string, error) {
+					if role == "guest" {
+						return "user", "/USER", act, nil
+					}
+					return role, obj, act, nil
+				},
+				SuccessFunc: func(role string, obj string, act string) {
+					result = []string{role, obj, act}
+				},
+			}
+			e.Use(CasbinWithConfig(config))
+
+			assert.Equal(t, tc.statusCode, serve(e, tc.roles, "/account"))
+			assert.Equal(t, tc.role, role)
+			assert.Equal(t, tc.result, result)
+		})
+	}
+}
+
+func TestJWTWithConfig_AuthorizedRoleKey(t *testing.T) {
+	testCases := []struct {
+		name     string
+		roles    string
+		endpoint string
+		matchAll bool
+		key      string
+		role     any
+	}{
+		{"first", "user,admin", "/user", false, "", "user"},
+		{"second", "any,admin", "/admin", false, "", "admin"},
+		{"custom key", "user", "/user", false, "role", "user"},
+		{"match all", "user,admin", "/user", true, "", []string{"user", "admin"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+
+			key := tc.key
+			if key == "" {
+				key = "authorized_role"
+			}
+
+			e.GET(tc.endpoint, func(c echo.Context) error {
+				assert.Equal(t, tc.role, c.Get(key))
+				return c.JSON(http.StatusOK, "ok")
+			})
+
+			config := Config{
+				Enforcer:          enforcer,
+				EnableRolesHeader: true,
+				MatchAllRoles:     tc.matchAll,
+				AuthorizedRoleKey: tc.key,
+			}
+			e.Use(CasbinWithConfig(config))
+
+			req := httptest.NewRequest(http.MethodGet, tc.endpoint, nil)
+			req.Header.Add("X-Roles", tc.roles)
+			resp := httptest.NewRecorder()
+
+			e.ServeHTTP(resp, req)
+
+			assert.Equal(t, http.StatusOK, resp.Code)
+		})
+	}
+}
+
+func TestJWTWithConfig_RolesHeaderDelimiter(t *testing.T) {
+	testCases := []struct {
+		name       string
+		delimiter  string
+		roles      string
+		endpoint   string
+		statusCode int
+	}{
+		{"semicolon first role", ";", "admin;user", "/admin", http.StatusOK},
+		{"semicolon second role", ";", "user;admin", "/admin", http.StatusOK},
+		{"semicolon denied", ";", "any;user", "/admin", http.StatusForbidden},
+		{"space", " ", "user admin", "/admin", http.StatusOK},
+		{"default splits on commas only", "", "user;admin", "/admin", http.StatusForbidden},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+
+			e.GET(tc.endpoint, func(c echo.Context) error {
+				return c.JSON(http.StatusOK, "ok")
+			})
+
+			config := Config{
+				Enforcer:             enforcer,
+				EnableRolesHeader:    true,
+				RolesHeaderDelimiter: tc.delimiter,
+			}
+			e.Use(CasbinWithConfig(config))
+
+			req := httptest.NewRequest(http.MethodGet, tc.endpoint, nil)
+			req.Header.Add("X-Roles", tc.roles)
+			resp := httptest.NewRecorder()
+
+			e.ServeHTTP(resp, req)
+
+			assert.Equal(t, tc.statusCode, resp.Code)
+		})
+	}
+}
+
+func TestJWTWithConfig_MergeRoleSources(t *testing.T) {
+	testCases := []struct {
+		name       string
+		merge      bool
+		ctxRoles   []string
+		roles      string
+		endpoint   string
+		statusCode int
+	}{
+		{"merged", true, []string{"user"}, "admin", "/admin", http.StatusOK},
+		{"merged duplicates", true, []string{"user"}, "user", "/admin", http.StatusForbidden},
+		{"merged context only", true, []string{"admin"}, "", "/admin", http.StatusOK},
+		{"merged header only", true, nil, "admin", "/admin", http.StatusOK},
+		{"exclusive", false, []string{"user"}, "admin", "/admin", http.StatusForbidden},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+
+			e.GET(tc.endpoint, func(c echo.Context) error {
+				return c.JSON(http.StatusOK, "ok")
+			})
+
+			e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+				return func(c echo.Context) error {
+					if tc.ctxRoles != nil {
+						c.Set("roles", tc.ctxRoles)
+					}
+					return next(c)
+				}
+			})
+
+			var enforced []string
+			config := Config{
+				Enforcer:          enforcer,
+				EnableRolesHeader: true,
+				MergeRoleSources:  tc.merge,
+				BeforeEnforce: func(c echo.Context, sub string, obj string, act string) (string, string, string, error) {
+					enforced = append(enforced, sub)
+					return sub, obj, act, nil
+				},
+			}
+			e.Use(CasbinWithConfig(config))
+
+			req := httptest.NewRequest(http.MethodGet, tc.endpoint, nil)
+			if tc.roles != "" {
+				req.Header.Add("X-Roles", tc.roles)
+			}
+			resp := httptest.NewRecorder()
+
+			e.ServeHTTP(resp, req)
+
+			assert.Equal(t, tc.statusCode, resp.Code)
+			seen := map[string]bool{}
+			for _, sub := range enforced {
+				assert.False(t, seen[sub], "role %q enforced more than once", sub)
+				seen[sub] = true
+			}
+		})
+	}
+}
+
+func TestJWTWithConfig_DuplicateRoles(t *testing.T) {
+	testCases := []struct {
+		name       string
+		roles      string
+		endpoint   string
+		statusCode int
+		count      int64
+		failures   []string
+	}{
+		{"repeated denied", "any,any,user,any", "/admin", http.StatusForbidden, 2, []string{"any", "user"}},
+		{"repeated allowed", "user,user", "/user", http.StatusOK, 1, nil},
+		{"normalized", "User,user", "/admin", http.StatusForbidden, 1, []string{"user"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+
+			e.GET(tc.endpoint, func(c echo.Context) error {
+				return c.JSON(http.StatusOK, "ok")
+			})
+
+			var failures []string
+			ce := &countingEnforcer{Enforcer: enforcer}
+			config := Config{
+				Enforcer:          ce,
+				EnableRolesHeader: true,
+				NormalizeSubject:  strings.ToLower,
+				FailureFunc: func(roles []string, obj string, act string) {
+					failures = append(failures, roles...)
+				},
+			}
+			e.Use(CasbinWithConfig(config))
+
+			req := httptest.NewRequest(http.MethodGet, tc.endpoint, nil)
+			req.Header.Add("X-Roles", tc.roles)
+			resp := httptest.NewRecorder()
+
+			e.ServeHTTP(resp, req)
+
+			assert.Equal(t, tc.statusCode, resp.Code)
+			assert.Equal(t, tc.count, ce.count.Load())
+			assert.Equal(t, tc.failures, failures)
+		})
+	}
+}
+
+type errorEnforcer struct {
+	*casbin.Enforcer
+	fail map[string]bool
+}
+
+func (e *errorEnforcer) Enforce(rvals ...interface{}) (bool, error) {
+	if e.fail[rvals[0].(string)] {
+		return false, errors.New("adapter unavailable")
+	}
+	return e.Enforcer.Enforce(rvals...)
+}
+
+func TestJWTWithConfig_FailOpen(t *testing.T) {
+	testCases := []struct {
+		name       string
+		failOpen   bool
+		matchAll   bool
+		roles      string
+		endpoint   string
+		statusCode int
+		errors     []string
+	}{
+		{"fail closed", false, false, "broken", "/admin", http.StatusInternalServerError, nil},
+		{"fail closed after denied role", false, false, "any,broken", "/admin", http.StatusInternalServerError, nil},
+		{"erroring role allowed", true, false, "broken", "/admin", http.StatusOK, []string{"broken"}},
+		{"denied then erroring role allowed", true, false, "any,broken", "/admin", http.StatusOK, []string{"broken"}},
+		{"allowed role before erroring role", true, false, "admin,broken", "/admin", http.StatusOK, nil},
+		{"match all erroring and allowed", true, true, "broken,admin", "/admin", http.StatusOK, []string{"broken"}},
+		{"match all erroring and denied", true, true, "broken,user", "/admin", http.StatusForbidden, []string{"broken"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+
+			e.GET(tc.endpoint, func(c echo.Context) error {
+				return c.JSON(http.StatusOK, "ok")
+			})
+
+			var errs []string
+			config := Config{
+				Enforcer:          &errorEnforcer{Enforcer: enforcer, fail: map[string]bool{"broken": true}},
+				EnableRolesHeader: true,
+				MatchAllRoles:     tc.matchAll,
+				FailOpen:          tc.failOpen,
+				OnEnforceError: func(c echo.Context, role string, obj string, act string, err error) {
+					assert.Equal(t, tc.endpoint, obj)
+					assert.Equal(t, http.MethodGet, act)
+					assert.EqualError(t, err, "adapter unavailable")
+					errs = append(errs, role)
+				},
+			}
+			e.Use(CasbinWithConfig(config))
+
+			req := httptest.NewRequest(http.MethodGet, tc.endpoint, nil)
+			req.Header.Add("X-Roles", tc.roles)
+			resp := httptest.NewRecorder()
+
+			e.ServeHTTP(resp, req)
+
+			assert.Equal(t, tc.statusCode, resp.Code)
+			assert.Equal(t, tc.errors, errs)
+		})
+	}
+}
+
+func TestJWTWithConfig_DefaultRoles(t *testing.T) {
+	testCases := []struct {
+		name         string
+		defaultRoles []string
+		header       bool
+		fn           func(string) ([]string, error)
+		endpoint     string
+		statusCode   int
+	}{
+		{"empty roles", []string{"anonymous", "user"}, false, nil, "/user", http.StatusOK},
+		{"empty roles denied", []string{"anonymous", "public"}, false, nil, "/user", http.StatusForbidden},
+		{"empty header", []string{"anonymous", "user"}, true, nil, "/user", http.StatusOK},
+		{"empty header denied", []string{"anonymous", "public"}, true, nil, "/user", http.StatusForbidden},
+		{"empty header with func", []string{"anonymous", "user"}, true, rolesHeader, "/user", http.StatusOK},
+		{"default role", nil, true, nil, "/", http.StatusOK},
+		{"default role denied", nil, true, nil, "/user", http.StatusForbidden},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+
+			e.GET(tc.endpoint, func(c echo.Context) error {
+				return c.JSON(http.StatusOK, "ok")
+			})
+
+			config := Config{
+				Enforcer:          enforcer,
+				EnableRolesHeader: tc.header,
+				RolesHeaderFunc:   tc.fn,
+				DefaultRoles:      tc.defaultRoles,
+			}
+			e.Use(CasbinWithConfig(config))
+
+			req := httptest.NewRequest(http.MethodGet, tc.endpoint, nil)
+			resp := httptest.NewRecorder()
+
+			e.ServeHTTP(resp, req)
+
+			assert.Equal(t, tc.statusCode, resp.Code)
+		})
+	}
+}
+
+func TestJWTWithConfig_DefaultRolesNotShared(t *testing.T) {
+	testCases := []struct {
+		name   string
+		header bool
+	}{
+		{"context", false},
+		{"header", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+
+			e.GET("/", func(c echo.Context) error {
+				c.Get("resolved_roles").([]string)[0] = "admin"
+				c.Get("authorized_role").([]string)[0] = "admin"
+				return c.JSON(http.StatusOK, "ok")
+			})
+
+			e.GET("/admin", func(c echo.Context) error {
+				return c.JSON(http.StatusOK, "ok")
+			})
+
+			config := Config{
+				Enforcer:          enforcer,
+				EnableRolesHeader: tc.header,
+				MatchAllRoles:     true,
+			}
+			e.Use(CasbinWithConfig(config))
+
+			assert.Equal(t, http.StatusOK, serve(e, "", "/"))
+			assert.Equal(t, http.StatusForbidden, serve(e, "", "/admin"))
+		})
+	}
+}
+
+func TestJWTWithConfig_AuthorizedRoleHeader(t *testing.T) {
+	testCases := []struct {
+		name       string
+		enable     bool
+		header     string
+		matchAll   bool
+		roles      string
+		endpoint   string
+		statusCode int
+		expected   string
+	}{
+		{"enabled", true, "", false, "any,admin", "/admin", http.StatusOK, "admin"},
+		{"custom header", true, "X-Role", false, "user", "/user", http.StatusOK, "user"},
+		{"match all", true, "", true, "user,admin", "/user", http.StatusOK, "user,admin"},
+		{"denied", true, "", false, "user", "/admin", http.StatusForbidden, ""},
+		{"disabled", false, "", false, "admin", "/admin", http.StatusOK, ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+
+			e.GET(tc.endpoint, func(c echo.Context) error {
+				return c.JSON(http.StatusOK, "ok")
+			})
+
+			config := Config{
+				Enforcer:                   enforcer,
+				EnableRolesHeader:          true,
+				MatchAllRoles:              tc.matchAll,
+				EnableAuthorizedRoleHeader: tc.enable,
+				AuthorizedRoleHeader:       tc.header,
+			}
+			e.Use(CasbinWithConfig(config))
+
+			req := httptest.NewRequest(http.MethodGet, tc.endpoint, nil)
+			req.Header.Add("X-Roles", tc.roles)
+			resp := httptest.NewRecorder()
+
+			e.ServeHTTP(resp, req)
+
+			header := tc.header
+			if header == "" {
+				header = "X-Authorized-Role"
+			}
+
+			assert.Equal(t, tc.statusCode, resp.Code)
+			assert.Equal(t, tc.expected, resp.Header().Get(header))
+			if !tc.enable {
+				assert.NotContains(t, resp.Header(), header)
+			}
+		})
+	}
+}
+
+func TestJWTWithConfig_TrimTrailingSlash(t *testing.T) {
+	testCases := []struct {
+		name       string
+		trim       bool
+		roles      string
+		endpoint   string
+		statusCode int
+		obj        string
+	}{
+		{"trailing slash", true, "user", "/user/", http.StatusOK, "/user"},
+		{"single slash only", true, "user", "/user//", http.StatusForbidden, "/user/"},
+		{"no trailing slash", true, "user", "/user", http.StatusOK, "/user"},
+		{"root", true, "any", "/", http.StatusOK, "/"},
+		{"disabled", false, "user", "/user/", http.StatusForbidden, "/user/"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+
+			e.GET(tc.endpoint, func(c echo.Context) error {
+				return c.JSON(http.StatusOK, "ok")
+			})
+
+			var obj string
+			config := Config{
+				Enforcer:          enforcer,
+				EnableRolesHeader: true,
+				TrimTrailingSlash: tc.trim,
+				OnDecision: func(c echo.Context, allowed bool, roles []string, o string, act string) {
+					obj = o
+				},
+			}
+			e.Use(CasbinWithConfig(config))
+
+			req := httptest.NewRequest(http.MethodGet, tc.endpoint, nil)
+			req.Header.Add("X-Roles", tc.roles)
+			resp := httptest.NewRecorder()
+
+			e.ServeHTTP(resp, req)
+
+			assert.Equal(t, tc.statusCode, resp.Code)
+			assert.Equal(t, tc.obj, obj)
+		})
+	}
+}
+
+func TestJWTWithConfig_EnforcedMethods(t *testing.T) {
+	testCases := []struct {
+		name       string
+		methods    []string
+		method     string
+		statusCode int
+	}{
+		{"skipped", []string{"POST", "PUT", "PATCH", "DELETE"}, http.MethodGet, http.StatusOK},
+		{"enforced", []string{"POST", "PUT", "PATCH", "DELETE"}, http.MethodDelete, http.StatusForbidden},
+		{"case-insensitive", []string{"delete"}, http.MethodDelete, http.StatusForbidden},
+		{"empty enforces all", nil, http.MethodGet, http.StatusForbidden},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+
+			e.Match([]string{http.MethodGet, http.MethodDelete}, "/admin", func(c echo.Context) error {
+				return c.JSON(http.StatusOK, "ok")
+			})
+
+			config := Config{
+				Enforcer:          enforcer,
+				EnableRolesHeader: true,
+				EnforcedMethods:   tc.methods,
+			}
+			e.Use(CasbinWithConfig(config))
+
+			req := httptest.NewRequest(tc.method, "/admin", nil)
+			req.Header.Add("X-Roles", "user")
+			resp := httptest.NewRecorder()
+
+			e.ServeHTTP(resp, req)
+
+			assert.Equal(t, tc.statusCode, resp.Code)
+		})
+	}
+}
+
+func TestJWTWithConfig_EnforcerFunc(t *testing.T) {
+	tenant2, err := casbin.NewEnforcer("./fixtures/model.conf")
+	assert.NoError(t, err)
+	_, err = tenant2.AddPolicy("user", "/admin", "GET")
+	assert.NoError(t, err)
+
+	enforcers := map[string]casbin.IEnforcer{
+		"tenant1": enforcer,
+		"tenant2": tenant2,
+		"tenant3": (*casbin.Enforcer)(nil),
+	}
+
+	testCases := []struct {
+		name       string
+		tenant     string
+		statusCode int
+	}{
+		{"tenant1", "tenant1", http.StatusForbidden},
+		{"tenant2", "tenant2", http.StatusOK},
+		{"nil enforcer", "tenant3", http.StatusInternalServerError},
+		{"error", "unknown", http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+
+			e.GET("/admin", func(c echo.Context) error {
+				return c.JSON(http.StatusOK, "ok")
+			})
+
+			config := Config{
+				EnforcerFunc: func(c echo.Context) (casbin.IEnforcer, error) {
+					ce, ok := enforcers[c.Request().Header.Get("X-Tenant")]
+					if !ok {
+						return nil, echo.NewHTTPError(http.StatusBadRequest, "unknown tenant")
+					}
+					return ce, nil
+				},
+				EnableRolesHeader: true,
+			}
+			e.Use(CasbinWithConfig(config))
+
+			req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+			req.Header.Add("X-Roles", "user")
+			req.Header.Add("X-Tenant", tc.tenant)
+			resp := httptest.NewRecorder()
+
+			e.ServeHTTP(resp, req)
+
+			assert.Equal(t, tc.statusCode, resp.Code)
+		})
+	}
+}
+
+type employee struct {
+	Name       string
+	Department string
+}
+
+func TestJWTWithConfig_SubjectFunc(t *testing.T) {
+	ae, err := casbin.NewEnforcer("./fixtures/model_abac.conf", "./fixtures/policy_abac.csv")
+	assert.NoError(t, err)
+
+	employees := map[string]employee{
+		"alice": {Name: "alice", Department: "engineering"},
+		"bob":   {Name: "bob", Department: "finance"},
+	}
+
+	testCases := []struct {
+		name       string
+		user       string
+		endpoint   string
+		statusCode int
+	}{
+		{"engineering allowed", "alice", "/projects", http.StatusOK},
+		{"engineering denied", "alice", "/invoices", http.StatusForbidden},
+		{"finance allowed", "bob", "/invoices", http.StatusOK},
+		{"finance denied", "bob", "/projects", http.StatusForbidden},
+		{"error", "mallory", "/projects", http.StatusUnauthorized},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+
+			e.GET(tc.endpoint, func(c echo.Context) error {
+				return c.JSON(http.StatusOK, "ok")
+			})
+
+			ce := &countingEnforcer{Enforcer: ae}
+			config := Config{
+				Enforcer:          ce,
+				EnableRolesHeader: true,
+				SubjectFunc: func(c echo.Context) (interface{}, error) {
+					emp, ok := employees[c.Request().Header.Get("X-User")]
+					if !ok {
+						return nil, echo.ErrUnauthorized
+					}
+					return emp, nil
+				},
+			}
+			e.Use(CasbinWithConfig(config))
+
+			req := httptest.NewRequest(http.MethodGet, tc.endpoint, nil)
+			req.Header.Add("X-User", tc.user)
+			req.Header.Add("X-Roles", "user,admin")
+			resp := httptest.NewRecorder()
+
+			e.ServeHTTP(resp, req)
+
+			assert.Equal(t, tc.statusCode, resp.Code)
+			if tc.statusCode != http.StatusUnauthorized {
+				assert.Equal(t, int64(1), ce.count.Load())
+			}
+		})
+	}
+}
+
+func TestJWTWithConfig_SubjectFuncAndRolesFunc(t *testing.T) {
+	assert.PanicsWithValue(t, "SubjectFunc and RolesFunc are mutually exclusive", func() {
+		CasbinWithConfig(Config{
+			Enforcer: enforcer,
+			SubjectFunc: func(c echo.Context) (interface{}, error) {
+				return "user", nil
+			},
+			RolesFunc: func(c echo.Context) ([]string, error) {
+				return []string{"user"}, nil
+			},
+		})
+	})
+}
+
+func TestJWTWithConfig_Realm(t *testing.T) {
+	testCases := []struct {
+		name       string
+		code       int
+		realm      string
+		accept     string
+		roles      string
+		statusCode int
+		expected   string
+	}{
+		{"unauthorized", http.StatusUnauthorized, "", "", "user", http.StatusUnauthorized, `Bearer realm="Restricted"`},
+		{"custom realm", http.StatusUnauthorized, "api", "", "user", http.StatusUnauthorized, `Bearer realm="api"`},
+		{"text", http.StatusUnauthorized, "", echo.MIMETextPlain, "user", http.StatusUnauthorized, `Bearer realm="Restricted"`},
+		{"forbidden", 0, "api", "", "user", http.StatusForbidden, ""},
+		{"allowed", http.StatusUnauthorized, "", "", "admin", http.StatusOK, ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+
+			e.GET("/admin", func(c echo.Context) error {
+				return c.JSON(http.StatusOK, "ok")
+			})
+
+			config := Config{
+				Enforcer:            enforcer,
+				EnableRolesHeader:   true,
+				ForbiddenStatusCode: tc.code,
+				Realm:               tc.realm,
+			}
+			e.Use(CasbinWithConfig(config))
+
+			req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+			req.Header.Add("X-Roles", tc.roles)
+			if tc.accept != "" {
+				req.Header.Add(echo.HeaderAccept, tc.accept)
+			}
+			resp := httptest.NewRecorder()
+
+			e.ServeHTTP(resp, req)
+
+			assert.Equal(t, tc.statusCode, resp.Code)
+			if tc.expected == "" {
+				assert.NotContains(t, resp.Header(), echo.HeaderWWWAuthenticate)
+			} else {
+				assert.Equal(t, tc.expected, resp.Header().Get(echo.HeaderWWWAuthenticate))
+			}
+		})
+	}
+}
+
+func BenchmarkCasbinWithConfig(b *testing.B) {
+	benchmarks := []struct {
+		name     string
+		roles    string
+		ctxRoles interface{}
+	}{
+		{"default role", "", nil},
+		{"single role header", "admin", nil},
+		{"roles header", "any,user,admin", nil},
+		{"context roles", "", []interface{}{"any", "user", "admin"}},
+	}
+
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			e := echo.New()
+
+			h := CasbinWithConfig(Config{
+				Enforcer:          enforcer,
+				EnableRolesHeader: true,
+			})(func(c echo.Context) error {
+				return nil
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if bm.roles != "" {
+				req.Header.Add("X-Roles", bm.roles)
+			}
+			resp := httptest.NewRecorder()
+			c := e.NewContext(req, resp)
+			c.SetPath("/")
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				c.Set("roles", bm.ctxRoles)
+				if err := h(c); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestJWTWithConfig_ContextKeys(t *testing.T) {
+	testCases := []struct {
+		name       string
+		keys       []string
+		values     map[string]interface{}
+		endpoint   string
+		statusCode int
+		roles      []string
+	}{
+		{
+			"merged",
+			[]string{"roles", "scopes", "groups"},
+			map[string]interface{}{"scopes": []string{"any"}, "groups": []interface{}{"admin", 1}},
+			"/admin", http.StatusOK, []string{"any", "admin"},
+		},
+		{
+			"duplicates",
+			[]string{"roles", "scopes"},
+			map[string]interface{}{"roles": []string{"user"}, "scopes": []interface{}{"user", "any"}},
+			"/admin", http.StatusForbidden, []string{"user", "any"},
+		},
+		{
+			"none found",
+			[]string{"roles", "scopes"},
+			map[string]interface{}{"groups": []string{"admin"}},
+			"/admin", http.StatusForbidden, []string{"any"},
+		},
+		{
+			"context key",
+			nil,
+			map[string]interface{}{"roles": []string{"admin"}, "scopes": []string{"any"}},
+			"/admin", http.StatusOK, []string{"admin"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+
+			e.GET(tc.endpoint, func(c echo.Context) error {
+				return c.JSON(http.StatusOK, "ok")
+			})
+
+			e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+				return func(c echo.Context) error {
+					for k, v := range tc.values {
+						c.Set(k, v)
+					}
+					return next(c)
+				}
+			})
+
+			var roles []string
+			config := Config{
+				Enforcer:    enforcer,
+				ContextKeys: tc.keys,
+				OnDecision: func(c echo.Context, allowed bool, r []string, obj string, act string) {
+					roles = r
+				},
+			}
+			e.Use(CasbinWithConfig(config))
+
+			req := httptest.NewRequest(http.MethodGet, tc.endpoint, nil)
+			resp := httptest.NewRecorder()
+
+			e.ServeHTTP(resp, req)
+
+			assert.Equal(t, tc.statusCode, resp.Code)
+			assert.Equal(t, tc.roles, roles)
+		})
+	}
+}
+
+type namedRoles []string
+
+type roleName string
+
+type principal struct {
+	Roles []string
+}
+
+func TestJWTWithConfig_RolesTypeFunc(t *testing.T) {
+	testCases := []struct {
+		name       string
+		value      interface{}
+		fn         func(interface{}) ([]string, error)
+		statusCode int
+	}{
+		{"named slice", namedRoles{"any", "admin"}, nil, http.StatusOK},
+		{"slice of named strings", []roleName{"admin"}, nil, http.StatusOK},
+		{"unrecognized type", principal{Roles: []string{"admin"}}, nil, http.StatusForbidden},
+		{
+			"func",
+			principal{Roles: []string{"admin"}},
+			func(v interface{}) ([]string, error) {
+				return v.(principal).Roles, nil
+			},
+			http.StatusOK,
+		},
+		{
+			"func error",
+			principal{Roles: []string{"admin"}},
+			func(v interface{}) ([]string, error) {
+				return nil, echo.NewHTTPError(http.StatusUnauthorized)
+			},
+			http.StatusUnauthorized,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+
+			e.GET("/admin", func(c echo.Context) error {
+				return c.JSON(http.StatusOK, "ok")
+			})
+
+			e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+				return func(c echo.Context) error {
+					c.Set("roles", tc.value)
+					return next(c)
+				}
+			})
+
+			config := Config{
+				Enforcer:      enforcer,
+				RolesTypeFunc: tc.fn,
+			}
+			e.Use(CasbinWithConfig(config))
+
+			req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+			resp := httptest.NewRecorder()
+
+			e.ServeHTTP(resp, req)
+
+			assert.Equal(t, tc.statusCode, resp.Code)
+		})
+	}
+}
+
+func TestJWTWithConfig_SkipUnmatchedRoutes(t *testing.T) {
+	testCases := []struct {
+		name       string
+		skip       bool
+		endpoint   string
+		statusCode int
+	}{
+		{"unmatched", true, "/unknown", http.StatusNotFound},
+		{"unmatched not skipped", false, "/unknown", http.StatusForbidden},
+		{"matched", true, "/admin", http.StatusForbidden},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+
+			e.GET("/admin", func(c echo.Context) error {
+				return c.JSON(http.StatusOK, "ok")
+			})
+
+			config := Config{
+				Enforcer:            enforcer,
+				EnableRolesHeader:   true,
+				SkipUnmatchedRoutes: tc.skip,
+			}
+			e.Use(CasbinWithConfig(config))
+
+			req := httptest.NewRequest(http.MethodGet, tc.endpoint, nil)
+			req.Header.Add("X-Roles", "user")
+			resp := httptest.NewRecorder()
+
+			e.ServeHTTP(resp, req)
+
+			assert.Equal(t, tc.statusCode, resp.Code)
+		})
+	}
+}
+
+func TestJWTWithConfig_DenyOnEmptyRoles(t *testing.T) {
+	testCases := []struct {
+		name       string
+		deny       bool
+		matchAll   bool
+		fn         func(string) ([]string, error)
+		roles      string
+		statusCode int
+		failures   int
+		count      int64
+	}{
+		{"empty header denied", true, false, nil, "", http.StatusForbidden, 1, 0},
+		{"empty header denied match all", true, true, nil, "", http.StatusForbidden, 1, 0},
+		{"empty header denied with func", true, false, rolesHeader, "", http.StatusForbidden, 1, 0},
+		{"roles", true, false, nil, "any", http.StatusOK, 0, 1},
+		{"default role", false, false, nil, "", http.StatusOK, 0, 1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+
+			e.GET("/", func(c echo.Context) error {
+				return c.JSON(http.StatusOK, "ok")
+			})
+
+			var failures int
+			ce := &countingEnforcer{Enforcer: enforcer}
+			config := Config{
+				Enforcer:          ce,
+				EnableRolesHeader: true,
+				RolesHeaderFunc:   tc.fn,
+				MatchAllRoles:     tc.matchAll,
+				DenyOnEmptyRoles:  tc.deny,
+				FailureFunc: func(roles []string, obj string, act string) {
+					assert.Empty(t, roles)
+					failures++
+				},
+			}
+			e.Use(CasbinWithConfig(config))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tc.roles != "" {
+				req.Header.Add("X-Roles", tc.roles)
+			}
+			resp := httptest.NewRecorder()
+
+			e.ServeHTTP(resp, req)
+
+			assert.Equal(t, tc.statusCode, resp.Code)
+			assert.Equal(t, tc.failures, failures)
+			assert.Equal(t, tc.count, ce.count.Load())
+		})
+	}
+}
+
+func TestJWTWithConfig_ResolvedRolesKey(t *testing.T) {
+	testCases := []struct {
+		name       string
+		key        string
+		roles      string
+		endpoint   string
+		statusCode int
+		expected   []string
+	}{
+		{"allowed", "", "user, admin", "/user", http.StatusOK, []string{"user", "admin"}},
+		{"default role", "", "", "/", http.StatusOK, []string{"any"}},
+		{"custom key", "roles_resolved", "admin", "/admin", http.StatusOK, []string{"admin"}},
+		{"denied", "", "user,user", "/admin", http.StatusForbidden, []string{"user"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+
+			key := tc.key
+			if key == "" {
+				key = "resolved_roles"
+			}
+
+			var resolved interface{}
+			e.GET(tc.endpoint, func(c echo.Context) error {
+				resolved = c.Get(key)
+				return c.JSON(http.StatusOK, "ok")
+			})
+
+			config := Config{
+				Enforcer:          enforcer,
+				EnableRolesHeader: true,
+				ResolvedRolesKey:  tc.key,
+				ErrorHandler: func(c echo.Context, roles []string, obj string, act string) error {
+					resolved = c.Get(key)
+					return c.NoContent(http.StatusForbidden)
+				},
+			}
+			e.Use(CasbinWithConfig(config))
+
+			req := httptest.NewRequest(http.MethodGet, tc.endpoint, nil)
+			if tc.roles != "" {
+				req.Header.Add("X-Roles", tc.roles)
+			}
+			resp := httptest.NewRecorder()
+
+			e.ServeHTTP(resp, req)
+
+			assert.Equal(t, tc.statusCode, resp.Code)
+			assert.Equal(t, tc.expected, resolved)
+		})
+	}
+}
+
+func TestJWTWithConfig_MatcherFunc(t *testing.T) {
+	relaxed := `g(r.sub, p.sub) && keyMatch4(r.obj, p.obj) && regexMatch(r.act, p.act) || r.sub == "superadmin"`
+	exact := `r.sub == p.sub && r.obj == p.obj && r.act == p.act`
+
+	testCases := []struct {
+		name       string
+		matcher    string
+		explain    bool
+		roles      string
+		endpoint   string
+		statusCode int
+	}{
+		{"default", "", false, "superadmin", "/admin", http.StatusForbidden},
+		{"relaxed", relaxed, false, "superadmin", "/admin", http.StatusOK},
+		{"relaxed with explain", relaxed, true, "superadmin", "/admin", http.StatusOK},
+		{"default user", "", false, "user", "/user", http.StatusOK},
+		{"exact user", exact, false, "user", "/user", http.StatusForbidden},
+		{"exact any", exact, true, "any", "/", http.StatusOK},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+
+			var caps interface{}
+			e.GET(tc.endpoint, func(c echo.Context) error {
+				caps = c.Get("capabilities")
+				return c.JSON(http.StatusOK, "ok")
+			})
+
+			config := Config{
+				Enforcer:          enforcer,
+				EnableRolesHeader: true,
+				EnableExplain:     tc.explain,
+				Capabilities:      map[string][]string{"/admin": {"GET"}},
+				CacheTTL:          time.Minute,
+				MatcherFunc: func(c echo.Context) string {
+					return c.Request().Header.Get("X-Matcher")
+				},
+			}
+			e.Use(CasbinWithConfig(config))
+
+			// the default matcher is cached first to ensure
+			// the results aren't shared across matchers
+			for _, matcher := range []string{"", tc.matcher} {
+				req := httptest.NewRequest(http.MethodGet, tc.endpoint, nil)
+				req.Header.Add("X-Roles", tc.roles)
+				req.Header.Add("X-Matcher", matcher)
+				resp := httptest.NewRecorder()
+
+				e.ServeHTTP(resp, req)
+
+				if matcher == tc.matcher {
+					assert.Equal(t, tc.statusCode, resp.Code)
+				}
+			}
+
+			if tc.matcher == relaxed {
+				assert.Equal(t, map[string]map[string]bool{"/admin": {"GET": true}}, caps)
+			}
+		})
+	}
+}
+
+func TestJWTWithConfig_IncludeDetailsInError(t *testing.T) {
+	testCases := []struct {
+		name       string
+		details    bool
+		roles      string
+		endpoint   string
+		objects    string
+		statusCode int
+		expected   map[string]string
+	}{
+		{
+			"details", true, "user", "/admin", "", http.StatusForbidden,
+			map[string]string{"message": "Access to this resource has been restricted", "object": "/admin", "action": "GET"},
+		},
+		{
+			"first denied object", true, "user", "/user", "/admin", http.StatusForbidden,
+			map[string]string{"message": "Access to this resource has been restricted", "object": "/admin", "action": "GET"},
+		},
+		{
+			"disabled", false, "user", "/admin", "", http.StatusForbidden,
+			map[string]string{"message": "Access to this resource has been restricted"},
+		},
+		{"allowed", true, "admin", "/admin", "", http.StatusOK, nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+
+			e.GET(tc.endpoint, func(c echo.Context) error {
+				return c.NoContent(http.StatusOK)
+			})
+
+			config := Config{
+				Enforcer:              enforcer,
+				EnableRolesHeader:     true,
+				EnableObjectsHeader:   true,
+				IncludeDetailsInError: tc.details,
+			}
+			e.Use(CasbinWithConfig(config))
+
+			req := httptest.NewRequest(http.MethodGet, tc.endpoint, nil)
+			req.Header.Add("X-Roles", tc.roles)
+			req.Header.Add("X-Target-Objects", tc.objects)
+			resp := httptest.NewRecorder()
+
+			e.ServeHTTP(resp, req)
+
+			assert.Equal(t, tc.statusCode, resp.Code)
+			if tc.expected != nil {
+				var body map[string]string
+				err := json.Unmarshal(resp.Body.Bytes(), &body)
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expected, body)
+			}
+		})
+	}
+}
+
+func TestJWTWithConfig_Group(t *testing.T) {
+	testCases := []struct {
+		name       string
+		prefix     string
+		endpoint   string
+		roles      string
+		statusCode int
+		obj        string
+	}{
+		{"group prefix", "", "/api/user", "user", http.StatusForbidden, "/api/user"},
+		{"group prefix with param", "", "/api/users/1", "user", http.StatusForbidden, "/api/users/:id"},
+		{"trimmed", "/api", "/api/user", "user", http.StatusOK, "/user"},
+		{"trimmed with param", "/api", "/api/users/1", "user", http.StatusForbidden, "/users/:id"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+
+			var obj string
+			config := Config{
+				Enforcer:          enforcer,
+				EnableRolesHeader: true,
+				TrimPrefix:        tc.prefix,
+				BeforeEnforce: func(c echo.Context, role string, o string, act string) (string, string, string, error) {
+					obj = o
+					return role, o, act, nil
+				},
+			}
+
+			g := e.Group("/api", CasbinWithConfig(config))
+			g.GET("/user", func(c echo.Context) error {
+				return c.JSON(http.StatusOK, "ok")
+			})
+			g.GET("/users/:id", func(c echo.Context) error {
+				return c.JSON(http.StatusOK, "ok")
+			})
+
+			req := httptest.NewRequest(http.MethodGet, tc.endpoint, nil)
+			req.Header.Add("X-Roles", tc.roles)
+			resp := httptest.NewRecorder()
+
+			e.ServeHTTP(resp, req)
+
+			assert.Equal(t, tc.statusCode, resp.Code)
+			assert.Equal(t, tc.obj, obj)
+		})
+	}
+}
+
+func TestJWTWithConfig_OnAllowOnDeny(t *testing.T) {
+	testCases := []struct {
+		name       string
+		roles      string
+		endpoint   string
+		objects    string
+		statusCode int
+		calls      []string
+	}{
+		{"allowed", "any,user", "/user", "", http.StatusOK, []string{"success user", "allow user [any user] /user GET req-1"}},
+		{"denied", "user", "/admin", "", http.StatusForbidden, []string{"failure", "deny [user] /admin GET req-1"}},
+		{
+			"denied objects", "any", "/", "/user,/admin", http.StatusForbidden,
+			[]string{
+				"failure",
+				"deny [any] /user GET req-1",
+				"failure",
+				"deny [any] /admin GET req-1",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+
+			e.GET(tc.endpoint, func(c echo.Context) error {
+				return c.JSON(http.StatusOK, "ok")
+			})
+
+			var calls []string
+			config := Config{
+				Enforcer:            enforcer,
+				EnableRolesHeader:   true,
+				EnableObjectsHeader: true,
+				SuccessFunc: func(role string, obj string, act string) {
+					calls = append(calls, "success "+role)
+				},
+				FailureFunc: func(roles []string, obj string, act string) {
+					calls = append(calls, "failure")
+				},
+				OnAllow: func(c echo.Context, matchedRole string, roles []string, obj string, act string) {
+					calls = append(calls, fmt.Sprintf("allow %s %v %s %s %s", matchedRole, roles, obj, act, c.Request().Header.Get("X-Request-Id")))
+				},
+				OnDeny: func(c echo.Context, roles []string, obj string, act string) {
+					calls = append(calls, fmt.Sprintf("deny %v %s %s %s", roles, obj, act, c.Request().Header.Get("X-Request-Id")))
+				},
+			}
+			e.Use(CasbinWithConfig(config))
+
+			req := httptest.NewRequest(http.MethodGet, tc.endpoint, nil)
+			req.Header.Add("X-Roles", tc.roles)
+			req.Header.Add("X-Target-Objects", tc.objects)
+			req.Header.Add("X-Request-Id", "req-1")
+			resp := httptest.NewRecorder()
+
+			e.ServeHTTP(resp, req)
+
+			assert.Equal(t, tc.statusCode, resp.Code)
+			assert.Equal(t, tc.calls, calls)
+		})
+	}
+}
+
+func TestJWTWithConfig_SubjectFromIP(t *testing.T) {
+	ie, err := casbin.NewEnforcer("./fixtures/model_ip.conf", "./fixtures/policy_ip.csv")
+	assert.NoError(t, err)
+
+	testCases := []struct {
+		name       string
+		remoteAddr string
+		xff        string
+		statusCode int
+	}{
+		{"allowed range", "10.1.2.3:1234", "", http.StatusOK},
+		{"allowed ip", "192.168.1.10:1234", "", http.StatusOK},
+		{"denied", "192.168.1.11:1234", "", http.StatusForbidden},
+		{"forwarded for ignored", "192.168.1.11:1234", "10.1.2.3", http.StatusForbidden},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+			e.IPExtractor = echo.ExtractIPDirect()
+
+			e.GET("/admin", func(c echo.Context) error {
+				return c.JSON(http.StatusOK, "ok")
+			})
+
+			config := Config{
+				Enforcer:          ie,
+				EnableRolesHeader: true,
+				SubjectFromIP:     true,
+			}
+			e.Use(CasbinWithConfig(config))
+
+			req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+			req.RemoteAddr = tc.remoteAddr
+			req.Header.Add("X-Roles", "admin")
+			if tc.xff != "" {
+				req.Header.Add(echo.HeaderXForwardedFor, tc.xff)
+			}
+			resp := httptest.NewRecorder()
+
+			e.ServeHTTP(resp, req)
+
+			assert.Equal(t, tc.statusCode, resp.Code)
+		})
+	}
+}
+
+type batchErrorEnforcer struct {
+	*casbin.Enforcer
+}
+
+func (e *batchErrorEnforcer) BatchEnforce(requests [][]interface{}) ([]bool, error) {
+	return nil, errors.New("batching not supported")
+}
+
+func TestJWTWithConfig_UseBatchEnforce(t *testing.T) {
+	testCases := []struct {
+		name       string
+		matchAll   bool
+		roles      string
+		endpoint   string
+		statusCode int
+		successes  []string
+	}{
+		{"allowed", false, "any,user,admin", "/admin", http.StatusOK, []string{"admin"}},
+		{"first allowed", false, "user,admin", "/user", http.StatusOK, []string{"user"}},
+		{"denied", false, "any,user", "/admin", http.StatusForbidden, nil},
+		{"match all allowed", true, "user,admin", "/user", http.StatusOK, []string{"user", "admin"}},
+		{"match all denied", true, "user,admin", "/admin", http.StatusForbidden, nil},
+	}
+
+	for _, tc := range testCases {
+		for _, mode := range []string{"loop", "batch", "fallback"} {
+			t.Run(tc.name+" "+mode, func(t *testing.T) {
+				e := echo.New()
+
+				e.GET(tc.endpoint, func(c echo.Context) error {
+					return c.JSON(http.StatusOK, "ok")
+				})
+
+				ce := &countingEnforcer{Enforcer: enforcer}
+				var ie casbin.IEnforcer = ce
+				if mode == "fallback" {
+					ie = &batchErrorEnforcer{Enforcer: enforcer}
+				}
+
+				var successes []string
+				config := Config{
+					Enforcer:          ie,
+					EnableRolesHeader: true,
+					MatchAllRoles:     tc.matchAll,
+					UseBatchEnforce:   mode != "loop",
+					SuccessFunc: func(role string, obj string, act string) {
+						successes = append(successes, role)
+					},
+				}
+				e.Use(CasbinWithConfig(config))
+
+				assert.Equal(t, tc.statusCode, serve(e, tc.roles, tc.endpoint))
+				assert.Equal(t, tc.successes, successes)
+				if mode == "batch" {
+					assert.Equal(t, int64(0), ce.count.Load())
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkUseBatchEnforce(b *testing.B) {
+	roles := "r1,r2,r3,r4,r5,r6,r7,r8,r9,admin"
+
+	for _, batch := range []bool{false, true} {
+		name := "loop"
+		if batch {
+			name = "batch"
+		}
+
+		b.Run(name, func(b *testing.B) {
+			e := echo.New()
+
+			h := CasbinWithConfig(Config{
+				Enforcer:          enforcer,
+				EnableRolesHeader: true,
+				UseBatchEnforce:   batch,
+			})(func(c echo.Context) error {
+				return nil
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+			req.Header.Add("X-Roles", roles)
+			c := e.NewContext(req, httptest.NewRecorder())
+			c.SetPath("/admin")
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := h(c); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestJWTWithConfig_SuperRole(t *testing.T) {
+	testCases := []struct {
+		name       string
+		superRole  string
+		matchAll   bool
+		normalize  func(string) string
+		roles      string
+		statusCode int
+		count      int64
+		successes  []string
+	}{
+		{"super role", "superadmin", false, nil, "any,superadmin", http.StatusOK, 0, []string{"superadmin"}},
+		{"super role match all", "superadmin", true, nil, "user,superadmin", http.StatusOK, 0, []string{"superadmin"}},
+		{"case-sensitive", "superadmin", false, nil, "SuperAdmin", http.StatusForbidden, 1, nil},
+		{"normalized", "superadmin", false, strings.ToLower, "SuperAdmin", http.StatusOK, 0, []string{"superadmin"}},
+		{"disabled", "", false, nil, "superadmin", http.StatusForbidden, 1, nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+
+			e.GET("/admin", func(c echo.Context) error {
+				return c.JSON(http.StatusOK, "ok")
+			})
+
+			var (
+				successes []string
+				decided   bool
+			)
+			ce := &countingEnforcer{Enforcer: enforcer}
+			config := Config{
+				Enforcer:          ce,
+				EnableRolesHeader: true,
+				SuperRole:         tc.superRole,
+				MatchAllRoles:     tc.matchAll,
+				NormalizeSubject:  tc.normalize,
+				SuccessFunc: func(role string, obj string, act string) {
+					successes = append(successes, role)
+				},
+				OnDecision: func(c echo.Context, allowed bool, roles []string, obj string, act string) {
+					decided = true
+				},
+			}
+			e.Use(CasbinWithConfig(config))
+
+			assert.Equal(t, tc.statusCode, serve(e, tc.roles, "/admin"))
+			assert.Equal(t, tc.count, ce.count.Load())
+			assert.Equal(t, tc.successes, successes)
+			assert.True(t, decided)
+		})
+	}
+}
+
+func TestJWTWithConfig_SuperRoleCapabilities(t *testing.T) {
+	testCases := []struct {
+		name         string
+		roles        string
+		permitted    map[string]bool
+		capabilities map[string]map[string]bool
+	}{
+		{
+			"super role", "superadmin",
+			map[string]bool{"GET": true, "DELETE": true},
+			map[string]map[string]bool{"/admin": {"GET": true, "DELETE": true}, "/user": {"POST": true}},
+		},
+		{
+			"admin", "admin",
+			map[string]bool{"GET": true, "DELETE": false},
+			map[string]map[string]bool{"/admin": {"GET": true, "DELETE": false}, "/user": {"POST": true}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+
+			var (
+				permitted    map[string]bool
+				capabilities map[string]map[string]bool
+			)
+			e.GET("/admin", func(c echo.Context) error {
+				permitted = c.Get("permitted_actions").(map[string]bool)
+				capabilities = c.Get("capabilities").(map[string]map[string]bool)
+				return c.JSON(http.StatusOK, "ok")
+			})
+
+			config := Config{
+				Enforcer:          enforcer,
+				EnableRolesHeader: true,
+				SuperRole:         "superadmin",
+				PermittedActions:  []string{"GET", "DELETE"},
+				Capabilities:      map[string][]string{"/admin": {"GET", "DELETE"}, "/user": {"POST"}},
+			}
+			e.Use(CasbinWithConfig(config))
+
+			assert.Equal(t, http.StatusOK, serve(e, tc.roles, "/admin"))
+			assert.Equal(t, tc.permitted, permitted)
+			assert.Equal(t, tc.capabilities, capabilities)
+		})
+	}
+}
+
+type cancelingEnforcer struct {
+	countingEnforcer
+	cancel context.CancelFunc
+}
+
+func (e *cancelingEnforcer) Enforce(rvals ...interface{}) (bool, error) {
+	e.cancel()
+	return e.countingEnforcer.Enforce(rvals...)
+}
+
+func TestJWTWithConfig_RequestCanceled(t *testing.T) {
+	testCases := []struct {
+		name     string
+		matchAll bool
+		roles    string
+	}{
+		{"any role", false, "any,user,admin"},
+		{"match all", true, "admin,user,any"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			ce := &cancelingEnforcer{countingEnforcer: countingEnforcer{Enforcer: enforcer}, cancel: cancel}
+			h := CasbinWithConfig(Config{
+				Enforcer:          ce,
+				EnableRolesHeader: true,
+				MatchAllRoles:     tc.matchAll,
+			})(func(c echo.Context) error {
+				return c.JSON(http.StatusOK, "ok")
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/admin", nil).WithContext(ctx)
+			req.Header.Add("X-Roles", tc.roles)
+			c := e.NewContext(req, httptest.NewRecorder())
+			c.SetPath("/admin")
+
+			err := h(c)
+			assert.ErrorIs(t, err, context.Canceled)
+			assert.Equal(t, int64(1), ce.count.Load())
+		})
+	}
+}
+
+func TestJWTWithConfig_RolesHeaderFuncCtx(t *testing.T) {
+	// the roles claimed in the header must be granted to the subject
+	grants := map[string][]string{
+		"alice": {"user", "admin"},
+		"bob":   {"user"},
+	}
+
+	testCases := []struct {
+		name       string
+		subject    string
+		roles      string
+		fn         func(string) ([]string, error)
+		statusCode int
+	}{
+		{"granted", "alice", "admin", nil, http.StatusOK},
+		{"not granted", "bob", "admin", nil, http.StatusUnauthorized},
+		{"takes precedence", "alice", "admin", rolesHeaderErr, http.StatusOK},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+
+			e.GET("/admin", func(c echo.Context) error {
+				return c.JSON(http.StatusOK, "ok")
+			})
+
+			e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+				return func(c echo.Context) error {
+					c.Set("subject", tc.subject)
+					return next(c)
+				}
+			})
+
+			config := Config{
+				Enforcer:          enforcer,
+				EnableRolesHeader: true,
+				RolesHeaderFunc:   tc.fn,
+				RolesHeaderFuncCtx: func(c echo.Context, header string) ([]string, error) {
+					roles, _ := rolesHeader(header)
+					granted := grants[c.Get("subject").(string)]
+					for _, role := range roles {
+						ok := false
+						for _, g := range granted {
+							ok = ok || g == role
+						}
+						if !ok {
+							return nil, echo.NewHTTPError(http.StatusUnauthorized, "role not granted")
+						}
+					}
+					return roles, nil
+				},
+			}
+			e.Use(CasbinWithConfig(config))
+
+			assert.Equal(t, tc.statusCode, serve(e, tc.roles, "/admin"))
+		})
+	}
+}
+
+func TestJWTWithConfig_EmptyRolesBehavior(t *testing.T) {
+	sources := map[string]func(config *Config){
+		"roles func": func(config *Config) {
+			config.RolesFunc = func(c echo.Context) ([]string, error) {
+				return []string{}, nil
+			}
+		},
+		"context": func(config *Config) {},
+		"header": func(config *Config) {
+			config.EnableRolesHeader = true
+		},
+		"header func": func(config *Config) {
+			config.EnableRolesHeader = true
+			config.RolesHeaderFunc = rolesHeader
+		},
+	}
+
+	testCases := []struct {
+		name       string
+		behavior   EmptyRolesBehavior
+		deny       bool
+		statusCode int
+		count      int64
+	}{
+		{"use default role", EmptyRolesUseDefaultRole, false, http.StatusOK, 1},
+		{"deny", EmptyRolesDeny, false, http.StatusForbidden, 0},
+		{"deny on empty roles", EmptyRolesUseDefaultRole, true, http.StatusForbidden, 0},
+		{"allow", EmptyRolesAllow, false, http.StatusOK, 0},
+	}
+
+	for _, tc := range testCases {
+		for source, configure := range sources {
+			t.Run(tc.name+" "+source, func(t *testing.T) {
+				e := echo.New()
+
+				e.GET("/", func(c echo.Context) error {
+					return c.JSON(http.StatusOK, "ok")
+				})
+
+				e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+					return func(c echo.Context) error {
+						c.Set("roles", []string{})
+						return next(c)
+					}
+				})
+
+				ce := &countingEnforcer{Enforcer: enforcer}
+				config := Config{
+					Enforcer:           ce,
+					EmptyRolesBehavior: tc.behavior,
+					DenyOnEmptyRoles:   tc.deny,
+				}
+				configure(&config)
+				e.Use(CasbinWithConfig(config))
+
+				req := httptest.NewRequest(http.MethodGet, "/", nil)
+				resp := httptest.NewRecorder()
+
+				e.ServeHTTP(resp, req)
+
+				assert.Equal(t, tc.statusCode, resp.Code)
+				assert.Equal(t, tc.count, ce.count.Load())
+			})
+		}
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	rolesFunc := func(c echo.Context) ([]string, error) { return nil, nil }
+	subjectFunc := func(c echo.Context) (interface{}, error) { return nil, nil }
+	domainFunc := func(c echo.Context) (string, error) { return "", nil }
+	de, err := casbin.NewEnforcer("./fixtures/model_domains.conf", "./fixtures/policy_domains.csv")
+	assert.NoError(t, err)
+
+	testCases := []struct {
+		name   string
+		config Config
+		err    string
+	}{
+		{"valid", Config{Enforcer: enforcer}, ""},
+		{"valid enforcer func", Config{EnforcerFunc: func(c echo.Context) (casbin.IEnforcer, error) { return enforcer, nil }}, ""},
+		{"no enforcer", Config{}, "enforcer is required"},
+		{"nil enforcer", Config{Enforcer: (*casbin.Enforcer)(nil)}, "enforcer is required"},
+		{"subject func and roles func", Config{Enforcer: enforcer, SubjectFunc: subjectFunc, RolesFunc: rolesFunc}, "SubjectFunc and RolesFunc are mutually exclusive"},
+		{"subject from ip and roles func", Config{Enforcer: enforcer, SubjectFromIP: true, RolesFunc: rolesFunc}, "SubjectFunc and RolesFunc are mutually exclusive"},
+		{"negative timeout", Config{Enforcer: enforcer, EnforceTimeout: -time.Second}, "EnforceTimeout must not be negative, got -1s"},
+		{"negative cache ttl", Config{Enforcer: enforcer, CacheTTL: -time.Minute}, "CacheTTL must not be negative, got -1m0s"},
+		{"negative cache size", Config{Enforcer: enforcer, CacheSize: -1}, "CacheSize must not be negative, got -1"},
+		{"invalid status code", Config{Enforcer: enforcer, ForbiddenStatusCode: http.StatusOK}, "ForbiddenStatusCode must be a 4xx or 5xx status code, got 200"},
+		{"subject format without domain func", Config{Enforcer: enforcer, SubjectFormat: "{domain}:{role}"}, "SubjectFormat requires a DomainFunc"},
+		{"unknown empty roles behavior", Config{Enforcer: enforcer, EmptyRolesBehavior: 42}, "unknown EmptyRolesBehavior 42"},
+		{"domains model", Config{Enforcer: de, DomainFunc: domainFunc}, ""},
+		{"domains model without domain func", Config{Enforcer: de}, "model expects 4 request tokens but middleware supplies 3; set DomainFunc"},
+		{"domains model with subject format", Config{Enforcer: de, DomainFunc: domainFunc, SubjectFormat: "{domain}:{role}"}, "model expects 4 request tokens but middleware supplies 3; unset SubjectFormat"},
+		{"domain func without domains", Config{Enforcer: enforcer, DomainFunc: domainFunc}, "model expects 3 request tokens but middleware supplies 4; unset DomainFunc or set SubjectFormat"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.config.Validate()
+			if tc.err == "" {
+				assert.NoError(t, err)
+				assert.NotPanics(t, func() { CasbinWithConfig(tc.config) })
+			} else {
+				assert.EqualError(t, err, tc.err)
+				assert.PanicsWithValue(t, tc.err, func() { CasbinWithConfig(tc.config) })
+			}
+		})
+	}
+}
+
+func TestJWTWithConfig_PublicEndpoints(t *testing.T) {
+	endpoints := []Endpoint{
+		{Method: "get", Path: "/openapi.json"},
+		{Method: http.MethodPost, Path: "/login"},
+	}
+
+	testCases := []struct {
+		name       string
+		method     string
+		endpoint   string
+		statusCode int
+	}{
+		{"public", http.MethodGet, "/openapi.json", http.StatusOK},
+		{"public other", http.MethodPost, "/login", http.StatusOK},
+		{"other method", http.MethodPost, "/openapi.json", http.StatusForbidden},
+		{"other path", http.MethodGet, "/login", http.StatusForbidden},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+
+			for _, path := range []string{"/openapi.json", "/login"} {
+				e.Match([]string{http.MethodGet, http.MethodPost}, path, func(c echo.Context) error {
+					return c.JSON(http.StatusOK, "ok")
+				})
+			}
+
+			config := Config{
+				Enforcer:        enforcer,
+				PublicEndpoints: endpoints,
+			}
+			e.Use(CasbinWithConfig(config))
+
+			assert.Equal(t, tc.statusCode, serveMethod(e, tc.method, "", tc.endpoint))
+		})
+	}
+}
+
+func TestJWTWithConfig_AfterAllow(t *testing.T) {
+	testCases := []struct {
+		name          string
+		roles         string
+		matchAll      bool
+		subjectFromIP bool
+		reloadLock    *sync.RWMutex
+		calls         []string
+	}{
+		{"matched role", "reader", false, false, nil, []string{"reader /articles GET"}},
+		{"reload lock", "reader", false, false, &ReloadLock, []string{"reader /articles GET"}},
+		{"match all roles", "reader,writer", true, false, nil, []string{"reader /articles GET", "writer /articles GET"}},
+		{"subject from ip", "", false, true, nil, []string{"192.0.2.1 /articles GET"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			se, err := NewStringEnforcer(testModel, testPolicy+"p, 192.0.2.1, /articles, GET\n")
+			assert.NoError(t, err)
+
+			e := echo.New()
+
+			e.Any("/articles", func(c echo.Context) error {
+				return c.JSON(http.StatusOK, "ok")
+			})
+
+			var calls []string
+			config := Config{
+				Enforcer:          se,
+				EnableRolesHeader: true,
+				MatchAllRoles:     tc.matchAll,
+				SubjectFromIP:     tc.subjectFromIP,
+				ReloadLock:        tc.reloadLock,
+				AfterAllow: func(c echo.Context, enforcer casbin.IEnforcer, role string, obj string, act string) error {
+					calls = append(calls, fmt.Sprintf("%s %s %s", role, obj, act))
+					return UpdateSafely(enforcer, func() error {
+						_, err := enforcer.AddPolicy(role, obj, http.MethodPost)
+						return err
+					})
+				},
+			}
+			e.Use(CasbinWithConfig(config))
+
+			role := strings.Split(tc.roles, ",")[0]
+			assert.Equal(t, http.StatusForbidden, serveMethod(e, http.MethodPost, role, "/articles"))
+			assert.Empty(t, calls)
+
+			assert.Equal(t, http.StatusOK, serveMethod(e, http.MethodGet, tc.roles, "/articles"))
+			assert.Equal(t, tc.calls, calls)
+
+			assert.Equal(t, http.StatusOK, serveMethod(e, http.MethodPost, role, "/articles"))
+		})
+	}
+}
+
+func TestJWTWithConfig_AfterAllowConcurrent(t *testing.T) {
+	se, err := NewStringEnforcer(testModel, testPolicy)
+	assert.NoError(t, err)
+
+	e := echo.New()
+
+	e.GET("/articles", func(c echo.Context) error {
+		return c.JSON(http.StatusOK, "ok")
+	})
+
+	config := Config{
+		Enforcer:          se,
+		EnableRolesHeader: true,
+		ReloadLock:        &ReloadLock,
+		AfterAllow: func(c echo.Context, enforcer casbin.IEnforcer, role string, obj string, act string) error {
+			if c.Request().Header.Get("X-Grant") == "" {
+				return nil
+			}
+			return UpdateSafely(enforcer, func() error {
+				_, err := enforcer.AddPolicy(c.Request().Header.Get("X-Grant"), obj, act)
+				return err
+			})
+		},
+		FailOnAfterAllowError: true,
+	}
+	e.Use(CasbinWithConfig(config))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 25; j++ {
+				req := httptest.NewRequest(http.MethodGet, "/articles", nil)
+				req.Header.Add("X-Roles", "reader")
+				if j%5 == 0 {
+					req.Header.Add("X-Grant", fmt.Sprintf("guest%d-%d", i, j))
+				}
+				resp := httptest.NewRecorder()
+
+				e.ServeHTTP(resp, req)
+
+				assert.Equal(t, http.StatusOK, resp.Code)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Equal(t, http.StatusOK, serve(e, "guest3-20", "/articles"))
+}
+
+func TestJWTWithConfig_AfterAllowError(t *testing.T) {
+	testCases := []struct {
+		name                  string
+		failOnAfterAllowError bool
+		statusCode            int
+	}{
+		{"ignored", false, http.StatusOK},
+		{"fail", true, http.StatusInternalServerError},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+
+			e.GET("/user", func(c echo.Context) error {
+				return c.JSON(http.StatusOK, "ok")
+			})
+
+			config := Config{
+				Enforcer:          enforcer,
+				EnableRolesHeader: true,
+				AfterAllow: func(c echo.Context, enforcer casbin.IEnforcer, role string, obj string, act string) error {
+					return errors.New("provisioning failed")
+				},
+				FailOnAfterAllowError: tc.failOnAfterAllowError,
+			}
+			e.Use(CasbinWithConfig(config))
+
+			assert.Equal(t, tc.statusCode, serve(e, "user", "/user"))
+		})
+	}
+}
+
+func TestNewDefaultConfig(t *testing.T) {
+	defaults := DefaultConfig
+	t.Cleanup(func() { DefaultConfig = defaults })
+
+	DefaultConfig.DefaultRoles = []string{"any"}
+	DefaultConfig.Capabilities = map[string][]string{"/user": {"GET"}}
+
+	c := NewDefaultConfig()
+	assert.Equal(t, DefaultConfig.RolesHeader, c.RolesHeader)
+	assert.Equal(t, []string{"any"}, c.DefaultRoles)
+	assert.Equal(t, map[string][]string{"/user": {"GET"}}, c.Capabilities)
+
+	c.Enforcer = enforcer
+	c.RolesHeader = "X-Groups"
+	c.DefaultRoles[0] = "guest"
+	c.Capabilities["/user"][0] = "POST"
+	c.Capabilities["/admin"] = []string{"GET"}
+
+	next := NewDefaultConfig()
+	assert.Nil(t, next.Enforcer)
+	assert.Equal(t, "X-Roles", next.RolesHeader)
+	assert.Equal(t, []string{"any"}, next.DefaultRoles)
+	assert.Equal(t, map[string][]string{"/user": {"GET"}}, next.Capabilities)
+	assert.Equal(t, []string{"any"}, DefaultConfig.DefaultRoles)
+	assert.Equal(t, map[string][]string{"/user": {"GET"}}, DefaultConfig.Capabilities)
+}
+
+func TestJWTWithConfig_SubjectFormat(t *testing.T) {
+	se, err := NewStringEnforcer(testModel, `
+p, tenant1:user, /x, GET
+p, tenant2:admin, /x, GET
+p, user:user, /x, GET
+p, user, /y, GET
+`)
+	assert.NoError(t, err)
+
+	testCases := []struct {
+		name       string
+		format     string
+		roles      string
+		tenant     string
+		endpoint   string
+		statusCode int
+	}{
+		{"allowed", "{domain}:{role}", "user", "tenant1", "/x", http.StatusOK},
+		{"allowed second role", "{domain}:{role}", "user,admin", "tenant2", "/x", http.StatusOK},
+		{"other tenant", "{domain}:{role}", "user", "tenant2", "/x", http.StatusForbidden},
+		{"plain role", "{domain}:{role}", "user", "tenant1", "/y", http.StatusForbidden},
+		{"reversed", "{role}@{domain}", "user", "tenant1", "/x", http.StatusForbidden},
+		{"role in domain", "{domain}:{role}", "user", "{role}", "/x", http.StatusForbidden},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+
+			e.GET(tc.endpoint, func(c echo.Context) error {
+				return c.JSON(http.StatusOK, "ok")
+			})
+
+			config := Config{
+				Enforcer:          se,
+				EnableRolesHeader: true,
+				DomainFunc: func(c echo.Context) (string, error) {
+					return c.Request().Header.Get("X-Tenant"), nil
+				},
+				SubjectFormat: tc.format,
+			}
+			e.Use(CasbinWithConfig(config))
+
+			req := httptest.NewRequest(http.MethodGet, tc.endpoint, nil)
+			req.Header.Add("X-Roles", tc.roles)
+			req.Header.Add("X-Tenant", tc.tenant)
+			resp := httptest.NewRecorder()
+
+			e.ServeHTTP(resp, req)
+
+			assert.Equal(t, tc.statusCode, resp.Code)
+		})
+	}
+}
+
+func TestJWTWithConfig_ForbiddenResponseField(t *testing.T) {
+	testCases := []struct {
+		name       string
+		field      string
+		details    bool
+		roles      string
+		statusCode int
+		expected   map[string]string
+	}{
+		{
+			"default", "", false, "user", http.StatusForbidden,
+			map[string]string{"message": "Access to this resource has been restricted"},
+		},
+		{
+			"custom", "error", false, "user", http.StatusForbidden,
+			map[string]string{"error": "Access to this resource has been restricted"},
+		},
+		{
+			"custom with details", "error", true, "user", http.StatusForbidden,
+			map[string]string{"error": "Access to this resource has been restricted", "object": "/admin", "action": "GET"},
+		},
+		{"allowed", "error", false, "admin", http.StatusOK, nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+
+			e.GET("/admin", func(c echo.Context) error {
+				return c.NoContent(http.StatusOK)
+			})
+
+			config := Config{
+				Enforcer:               enforcer,
+				EnableRolesHeader:      true,
+				ForbiddenResponseField: tc.field,
+				IncludeDetailsInError:  tc.details,
+			}
+			e.Use(CasbinWithConfig(config))
+
+			req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+			req.Header.Add("X-Roles", tc.roles)
+			resp := httptest.NewRecorder()
+
+			e.ServeHTTP(resp, req)
+
+			assert.Equal(t, tc.statusCode, resp.Code)
+			if tc.expected != nil {
+				var body map[string]string
+				err := json.Unmarshal(resp.Body.Bytes(), &body)
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expected, body)
+			}
+		})
+	}
+}
@@ -0,0 +1,20 @@
+package casbin
+
+import (
+	"github.com/casbin/casbin/v2"
+	"github.com/casbin/casbin/v2/model"
+	stringadapter "github.com/casbin/casbin/v2/persist/string-adapter"
+)
+
+// NewStringEnforcer creates an enforcer from the model and policy text,
+// in the same format as the model and policy files, e.g. to write
+// self-contained tests without fixture files. SavePolicy only updates
+// the policies in memory.
+func NewStringEnforcer(modelText string, policyText string) (*casbin.Enforcer, error) {
+	m, err := model.NewModelFromString(modelText)
+	if err != nil {
+		return nil, err
+	}
+
+	return casbin.NewEnforcer(m, stringadapter.NewAdapter(policyText))
+}
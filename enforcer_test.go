@@ -0,0 +1,73 @@
+package casbin
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+const testModel = `
+[request_definition]
+r = sub, obj, act
+
+[policy_definition]
+p = sub, obj, act
+
+[role_definition]
+g = _, _
+
+[policy_effect]
+e = some(where (p.eft == allow))
+
+[matchers]
+m = g(r.sub, p.sub) && keyMatch4(r.obj, p.obj) && r.act == p.act
+`
+
+const testPolicy = `
+p, reader, /articles, GET
+p, writer, /articles, POST
+g, writer, reader
+`
+
+func TestNewStringEnforcer(t *testing.T) {
+	se, err := NewStringEnforcer(testModel, testPolicy)
+	assert.NoError(t, err)
+
+	testCases := []struct {
+		name       string
+		roles      string
+		method     string
+		statusCode int
+	}{
+		{"reader get", "reader", http.MethodGet, http.StatusOK},
+		{"reader post", "reader", http.MethodPost, http.StatusForbidden},
+		{"writer get", "writer", http.MethodGet, http.StatusOK},
+		{"writer post", "writer", http.MethodPost, http.StatusOK},
+		{"anonymous", "", http.MethodGet, http.StatusForbidden},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+
+			e.Match([]string{http.MethodGet, http.MethodPost}, "/articles", func(c echo.Context) error {
+				return c.JSON(http.StatusOK, "ok")
+			})
+
+			config := Config{
+				Enforcer:          se,
+				EnableRolesHeader: true,
+			}
+			e.Use(CasbinWithConfig(config))
+
+			assert.Equal(t, tc.statusCode, serveMethod(e, tc.method, tc.roles, "/articles"))
+		})
+	}
+}
+
+func TestNewStringEnforcer_InvalidModel(t *testing.T) {
+	_, err := NewStringEnforcer("[request_definition]\n", testPolicy)
+	assert.Error(t, err)
+}
@@ -4,6 +4,7 @@ go 1.21
 
 require (
 	github.com/casbin/casbin/v2 v2.81.0
+	github.com/golang-jwt/jwt/v5 v5.2.0
 	github.com/labstack/echo/v4 v4.11.4
 	github.com/stretchr/testify v1.8.4
 )
@@ -0,0 +1,53 @@
+package casbin
+
+import (
+	"fmt"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+)
+
+// RolesFromJWTClaims returns a function, to be used as the RolesFunc,
+// that reads the roles from the claimName claim of the token set on
+// the echo.Context under contextKey, e.g. by echo-jwt. The token can be
+// a *jwt.Token with jwt.MapClaims or the jwt.MapClaims themselves and
+// the claim a string or a slice of strings. An empty slice is returned
+// when the claim is absent.
+func RolesFromJWTClaims(contextKey string, claimName string) func(echo.Context) ([]string, error) {
+	return func(c echo.Context) ([]string, error) {
+		var claims jwt.MapClaims
+		switch v := c.Get(contextKey).(type) {
+		case *jwt.Token:
+			mc, ok := v.Claims.(jwt.MapClaims)
+			if !ok {
+				return nil, fmt.Errorf("claims of token %q are %T, not jwt.MapClaims", contextKey, v.Claims)
+			}
+			claims = mc
+		case jwt.MapClaims:
+			claims = v
+		default:
+			return nil, fmt.Errorf("context key %q is %T, not a *jwt.Token", contextKey, v)
+		}
+
+		switch claim := claims[claimName].(type) {
+		case nil:
+			return []string{}, nil
+		case string:
+			return []string{claim}, nil
+		case []string:
+			return claim, nil
+		case []interface{}:
+			roles := make([]string, 0, len(claim))
+			for _, role := range claim {
+				s, ok := role.(string)
+				if !ok {
+					return nil, fmt.Errorf("claim %q contains %T, not a string", claimName, role)
+				}
+				roles = append(roles, s)
+			}
+			return roles, nil
+		default:
+			return nil, fmt.Errorf("claim %q is %T, not a string or a slice of strings", claimName, claim)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package casbin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRolesFromJWTClaims(t *testing.T) {
+	testCases := []struct {
+		name  string
+		value any
+		roles []string
+		err   bool
+	}{
+		{"token slice", jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"roles": []interface{}{"user", "admin"}}), []string{"user", "admin"}, false},
+		{"token string", jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"roles": "user"}), []string{"user"}, false},
+		{"token absent", jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "alice"}), []string{}, false},
+		{"claims string slice", jwt.MapClaims{"roles": []string{"admin"}}, []string{"admin"}, false},
+		{"registered claims", jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{}), nil, true},
+		{"invalid claim", jwt.MapClaims{"roles": 1}, nil, true},
+		{"invalid role", jwt.MapClaims{"roles": []interface{}{"user", 1}}, nil, true},
+		{"not a token", "user", nil, true},
+		{"missing", nil, nil, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+			c := e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+			c.Set("user", tc.value)
+
+			roles, err := RolesFromJWTClaims("user", "roles")(c)
+			if tc.err {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.roles, roles)
+		})
+	}
+}
+
+func TestJWTWithConfig_RolesFromJWTClaims(t *testing.T) {
+	testCases := []struct {
+		name       string
+		claims     jwt.MapClaims
+		statusCode int
+	}{
+		{"admin", jwt.MapClaims{"roles": []interface{}{"user", "admin"}}, http.StatusOK},
+		{"user", jwt.MapClaims{"roles": []interface{}{"user"}}, http.StatusForbidden},
+		{"absent", jwt.MapClaims{}, http.StatusForbidden},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+
+			e.GET("/admin", func(c echo.Context) error {
+				return c.JSON(http.StatusOK, "ok")
+			})
+
+			config := Config{
+				Enforcer:  enforcer,
+				RolesFunc: RolesFromJWTClaims("user", "roles"),
+			}
+
+			e.Use(
+				func(next echo.HandlerFunc) echo.HandlerFunc {
+					return func(c echo.Context) error {
+						c.Set("user", jwt.NewWithClaims(jwt.SigningMethodHS256, tc.claims))
+						return next(c)
+					}
+				},
+				CasbinWithConfig(config),
+			)
+
+			req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+			resp := httptest.NewRecorder()
+
+			e.ServeHTTP(resp, req)
+
+			assert.Equal(t, tc.statusCode, resp.Code)
+		})
+	}
+}
@@ -0,0 +1,648 @@
+package casbin
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/casbin/casbin/v2"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// Option configures a Config for CasbinWith.
+type Option func(*Config)
+
+// CasbinWith returns a Casbin middleware with the DefaultConfig
+// modified by the options.
+func CasbinWith(opts ...Option) echo.MiddlewareFunc {
+	config := NewDefaultConfig()
+	for _, opt := range opts {
+		opt(&config)
+	}
+
+	return CasbinWithConfig(config)
+}
+
+// WithSkipper sets the Skipper of the Config.
+func WithSkipper(skipper middleware.Skipper) Option {
+	return func(c *Config) {
+		c.Skipper = skipper
+	}
+}
+
+// WithSkipOptions sets the SkipOptions of the Config.
+func WithSkipOptions(skipOptions bool) Option {
+	return func(c *Config) {
+		c.SkipOptions = skipOptions
+	}
+}
+
+// WithEnforcedMethods sets the EnforcedMethods of the Config.
+func WithEnforcedMethods(enforcedMethods []string) Option {
+	return func(c *Config) {
+		c.EnforcedMethods = enforcedMethods
+	}
+}
+
+// WithSkipUnmatchedRoutes sets the SkipUnmatchedRoutes of the Config.
+func WithSkipUnmatchedRoutes(skipUnmatchedRoutes bool) Option {
+	return func(c *Config) {
+		c.SkipUnmatchedRoutes = skipUnmatchedRoutes
+	}
+}
+
+// WithPublicEndpoints sets the PublicEndpoints of the Config.
+func WithPublicEndpoints(publicEndpoints []Endpoint) Option {
+	return func(c *Config) {
+		c.PublicEndpoints = publicEndpoints
+	}
+}
+
+// WithEnforcer sets the Enforcer of the Config.
+func WithEnforcer(enforcer casbin.IEnforcer) Option {
+	return func(c *Config) {
+		c.Enforcer = enforcer
+	}
+}
+
+// WithEnforcerFunc sets the EnforcerFunc of the Config.
+func WithEnforcerFunc(enforcerFunc func(echo.Context) (casbin.IEnforcer, error)) Option {
+	return func(c *Config) {
+		c.EnforcerFunc = enforcerFunc
+	}
+}
+
+// WithContextKey sets the ContextKey of the Config.
+func WithContextKey(contextKey string) Option {
+	return func(c *Config) {
+		c.ContextKey = contextKey
+	}
+}
+
+// WithContextKeys sets the ContextKeys of the Config.
+func WithContextKeys(contextKeys []string) Option {
+	return func(c *Config) {
+		c.ContextKeys = contextKeys
+	}
+}
+
+// WithRolesTypeFunc sets the RolesTypeFunc of the Config.
+func WithRolesTypeFunc(rolesTypeFunc func(interface{}) ([]string, error)) Option {
+	return func(c *Config) {
+		c.RolesTypeFunc = rolesTypeFunc
+	}
+}
+
+// WithDefaultRole sets the DefaultRole of the Config.
+func WithDefaultRole(defaultRole string) Option {
+	return func(c *Config) {
+		c.DefaultRole = defaultRole
+	}
+}
+
+// WithDefaultRoles sets the DefaultRoles of the Config.
+func WithDefaultRoles(defaultRoles []string) Option {
+	return func(c *Config) {
+		c.DefaultRoles = defaultRoles
+	}
+}
+
+// WithDenyOnEmptyRoles sets the DenyOnEmptyRoles of the Config.
+func WithDenyOnEmptyRoles(denyOnEmptyRoles bool) Option {
+	return func(c *Config) {
+		c.DenyOnEmptyRoles = denyOnEmptyRoles
+	}
+}
+
+// WithEmptyRolesBehavior sets the EmptyRolesBehavior of the Config.
+func WithEmptyRolesBehavior(emptyRolesBehavior EmptyRolesBehavior) Option {
+	return func(c *Config) {
+		c.EmptyRolesBehavior = emptyRolesBehavior
+	}
+}
+
+// WithEnableRolesHeader sets the EnableRolesHeader of the Config.
+func WithEnableRolesHeader(enableRolesHeader bool) Option {
+	return func(c *Config) {
+		c.EnableRolesHeader = enableRolesHeader
+	}
+}
+
+// WithRolesHeader sets the RolesHeader of the Config.
+func WithRolesHeader(rolesHeader string) Option {
+	return func(c *Config) {
+		c.RolesHeader = rolesHeader
+	}
+}
+
+// WithRolesHeaderDelimiter sets the RolesHeaderDelimiter of the Config.
+func WithRolesHeaderDelimiter(rolesHeaderDelimiter string) Option {
+	return func(c *Config) {
+		c.RolesHeaderDelimiter = rolesHeaderDelimiter
+	}
+}
+
+// WithRolesHeaderFunc sets the RolesHeaderFunc of the Config.
+func WithRolesHeaderFunc(rolesHeaderFunc func(string) ([]string, error)) Option {
+	return func(c *Config) {
+		c.RolesHeaderFunc = rolesHeaderFunc
+	}
+}
+
+// WithRolesHeaderFuncCtx sets the RolesHeaderFuncCtx of the Config.
+func WithRolesHeaderFuncCtx(rolesHeaderFuncCtx func(c echo.Context, header string) ([]string, error)) Option {
+	return func(c *Config) {
+		c.RolesHeaderFuncCtx = rolesHeaderFuncCtx
+	}
+}
+
+// WithRolesFunc sets the RolesFunc of the Config.
+func WithRolesFunc(rolesFunc func(echo.Context) ([]string, error)) Option {
+	return func(c *Config) {
+		c.RolesFunc = rolesFunc
+	}
+}
+
+// WithSubjectFunc sets the SubjectFunc of the Config.
+func WithSubjectFunc(subjectFunc func(echo.Context) (interface{}, error)) Option {
+	return func(c *Config) {
+		c.SubjectFunc = subjectFunc
+	}
+}
+
+// WithSubjectFromIP sets the SubjectFromIP of the Config.
+func WithSubjectFromIP(subjectFromIP bool) Option {
+	return func(c *Config) {
+		c.SubjectFromIP = subjectFromIP
+	}
+}
+
+// WithGroupProvider sets the GroupProvider of the Config.
+func WithGroupProvider(groupProvider GroupProvider) Option {
+	return func(c *Config) {
+		c.GroupProvider = groupProvider
+	}
+}
+
+// WithMergeRoleSources sets the MergeRoleSources of the Config.
+func WithMergeRoleSources(mergeRoleSources bool) Option {
+	return func(c *Config) {
+		c.MergeRoleSources = mergeRoleSources
+	}
+}
+
+// WithSubjectContextKey sets the SubjectContextKey of the Config.
+func WithSubjectContextKey(subjectContextKey string) Option {
+	return func(c *Config) {
+		c.SubjectContextKey = subjectContextKey
+	}
+}
+
+// WithMatchAllRoles sets the MatchAllRoles of the Config.
+func WithMatchAllRoles(matchAllRoles bool) Option {
+	return func(c *Config) {
+		c.MatchAllRoles = matchAllRoles
+	}
+}
+
+// WithSuperRole sets the SuperRole of the Config.
+func WithSuperRole(superRole string) Option {
+	return func(c *Config) {
+		c.SuperRole = superRole
+	}
+}
+
+// WithNormalizeSubject sets the NormalizeSubject of the Config.
+func WithNormalizeSubject(normalizeSubject func(string) string) Option {
+	return func(c *Config) {
+		c.NormalizeSubject = normalizeSubject
+	}
+}
+
+// WithDomainFunc sets the DomainFunc of the Config.
+func WithDomainFunc(domainFunc func(echo.Context) (string, error)) Option {
+	return func(c *Config) {
+		c.DomainFunc = domainFunc
+	}
+}
+
+// WithSubjectFormat sets the SubjectFormat of the Config.
+func WithSubjectFormat(subjectFormat string) Option {
+	return func(c *Config) {
+		c.SubjectFormat = subjectFormat
+	}
+}
+
+// WithMatcherFunc sets the MatcherFunc of the Config.
+func WithMatcherFunc(matcherFunc func(echo.Context) string) Option {
+	return func(c *Config) {
+		c.MatcherFunc = matcherFunc
+	}
+}
+
+// WithUseRequestURI sets the UseRequestURI of the Config.
+func WithUseRequestURI(useRequestURI bool) Option {
+	return func(c *Config) {
+		c.UseRequestURI = useRequestURI
+	}
+}
+
+// WithObjectTemplate sets the ObjectTemplate of the Config.
+func WithObjectTemplate(objectTemplate string) Option {
+	return func(c *Config) {
+		c.ObjectTemplate = objectTemplate
+	}
+}
+
+// WithObjectFunc sets the ObjectFunc of the Config.
+func WithObjectFunc(objectFunc func(echo.Context) (string, error)) Option {
+	return func(c *Config) {
+		c.ObjectFunc = objectFunc
+	}
+}
+
+// WithTrimPrefix sets the TrimPrefix of the Config.
+func WithTrimPrefix(trimPrefix string) Option {
+	return func(c *Config) {
+		c.TrimPrefix = trimPrefix
+	}
+}
+
+// WithTrimTrailingSlash sets the TrimTrailingSlash of the Config.
+func WithTrimTrailingSlash(trimTrailingSlash bool) Option {
+	return func(c *Config) {
+		c.TrimTrailingSlash = trimTrailingSlash
+	}
+}
+
+// WithNormalizeMethod sets the NormalizeMethod of the Config.
+func WithNormalizeMethod(normalizeMethod bool) Option {
+	return func(c *Config) {
+		c.NormalizeMethod = normalizeMethod
+	}
+}
+
+// WithActionFunc sets the ActionFunc of the Config.
+func WithActionFunc(actionFunc func(echo.Context) (string, error)) Option {
+	return func(c *Config) {
+		c.ActionFunc = actionFunc
+	}
+}
+
+// WithBeforeEnforce sets the BeforeEnforce of the Config.
+func WithBeforeEnforce(beforeEnforce func(c echo.Context, role string, obj string, act string) (string, string, string, error)) Option {
+	return func(c *Config) {
+		c.BeforeEnforce = beforeEnforce
+	}
+}
+
+// WithNormalizeObject sets the NormalizeObject of the Config.
+func WithNormalizeObject(normalizeObject func(string) string) Option {
+	return func(c *Config) {
+		c.NormalizeObject = normalizeObject
+	}
+}
+
+// WithEnableObjectsHeader sets the EnableObjectsHeader of the Config.
+func WithEnableObjectsHeader(enableObjectsHeader bool) Option {
+	return func(c *Config) {
+		c.EnableObjectsHeader = enableObjectsHeader
+	}
+}
+
+// WithObjectsHeader sets the ObjectsHeader of the Config.
+func WithObjectsHeader(objectsHeader string) Option {
+	return func(c *Config) {
+		c.ObjectsHeader = objectsHeader
+	}
+}
+
+// WithObjectsHeaderDelimiter sets the ObjectsHeaderDelimiter of the Config.
+func WithObjectsHeaderDelimiter(objectsHeaderDelimiter string) Option {
+	return func(c *Config) {
+		c.ObjectsHeaderDelimiter = objectsHeaderDelimiter
+	}
+}
+
+// WithPermittedActions sets the PermittedActions of the Config.
+func WithPermittedActions(permittedActions []string) Option {
+	return func(c *Config) {
+		c.PermittedActions = permittedActions
+	}
+}
+
+// WithPermittedActionsKey sets the PermittedActionsKey of the Config.
+func WithPermittedActionsKey(permittedActionsKey string) Option {
+	return func(c *Config) {
+		c.PermittedActionsKey = permittedActionsKey
+	}
+}
+
+// WithEnableDecisionTrailer sets the EnableDecisionTrailer of the Config.
+func WithEnableDecisionTrailer(enableDecisionTrailer bool) Option {
+	return func(c *Config) {
+		c.EnableDecisionTrailer = enableDecisionTrailer
+	}
+}
+
+// WithDecisionTrailer sets the DecisionTrailer of the Config.
+func WithDecisionTrailer(decisionTrailer string) Option {
+	return func(c *Config) {
+		c.DecisionTrailer = decisionTrailer
+	}
+}
+
+// WithReadOnlyMode sets the ReadOnlyMode of the Config.
+func WithReadOnlyMode(readOnlyMode bool) Option {
+	return func(c *Config) {
+		c.ReadOnlyMode = readOnlyMode
+	}
+}
+
+// WithReadOnlyModeFunc sets the ReadOnlyModeFunc of the Config.
+func WithReadOnlyModeFunc(readOnlyModeFunc func() bool) Option {
+	return func(c *Config) {
+		c.ReadOnlyModeFunc = readOnlyModeFunc
+	}
+}
+
+// WithMaintenanceMessage sets the MaintenanceMessage of the Config.
+func WithMaintenanceMessage(maintenanceMessage string) Option {
+	return func(c *Config) {
+		c.MaintenanceMessage = maintenanceMessage
+	}
+}
+
+// WithRetryAfter sets the RetryAfter of the Config.
+func WithRetryAfter(retryAfter time.Duration) Option {
+	return func(c *Config) {
+		c.RetryAfter = retryAfter
+	}
+}
+
+// WithCapabilities sets the Capabilities of the Config.
+func WithCapabilities(capabilities map[string][]string) Option {
+	return func(c *Config) {
+		c.Capabilities = capabilities
+	}
+}
+
+// WithCapabilitiesKey sets the CapabilitiesKey of the Config.
+func WithCapabilitiesKey(capabilitiesKey string) Option {
+	return func(c *Config) {
+		c.CapabilitiesKey = capabilitiesKey
+	}
+}
+
+// WithEnableCapabilitiesHeader sets the EnableCapabilitiesHeader of the Config.
+func WithEnableCapabilitiesHeader(enableCapabilitiesHeader bool) Option {
+	return func(c *Config) {
+		c.EnableCapabilitiesHeader = enableCapabilitiesHeader
+	}
+}
+
+// WithCapabilitiesHeader sets the CapabilitiesHeader of the Config.
+func WithCapabilitiesHeader(capabilitiesHeader string) Option {
+	return func(c *Config) {
+		c.CapabilitiesHeader = capabilitiesHeader
+	}
+}
+
+// WithForbiddenMessage sets the ForbiddenMessage of the Config.
+func WithForbiddenMessage(forbiddenMessage string) Option {
+	return func(c *Config) {
+		c.ForbiddenMessage = forbiddenMessage
+	}
+}
+
+// WithForbiddenResponseField sets the ForbiddenResponseField of the Config.
+func WithForbiddenResponseField(forbiddenResponseField string) Option {
+	return func(c *Config) {
+		c.ForbiddenResponseField = forbiddenResponseField
+	}
+}
+
+// WithForbiddenStatusCode sets the ForbiddenStatusCode of the Config.
+func WithForbiddenStatusCode(forbiddenStatusCode int) Option {
+	return func(c *Config) {
+		c.ForbiddenStatusCode = forbiddenStatusCode
+	}
+}
+
+// WithIncludeDetailsInError sets the IncludeDetailsInError of the Config.
+func WithIncludeDetailsInError(includeDetailsInError bool) Option {
+	return func(c *Config) {
+		c.IncludeDetailsInError = includeDetailsInError
+	}
+}
+
+// WithRealm sets the Realm of the Config.
+func WithRealm(realm string) Option {
+	return func(c *Config) {
+		c.Realm = realm
+	}
+}
+
+// WithResolvedRolesKey sets the ResolvedRolesKey of the Config.
+func WithResolvedRolesKey(resolvedRolesKey string) Option {
+	return func(c *Config) {
+		c.ResolvedRolesKey = resolvedRolesKey
+	}
+}
+
+// WithAuthorizedRoleKey sets the AuthorizedRoleKey of the Config.
+func WithAuthorizedRoleKey(authorizedRoleKey string) Option {
+	return func(c *Config) {
+		c.AuthorizedRoleKey = authorizedRoleKey
+	}
+}
+
+// WithEnableAuthorizedRoleHeader sets the EnableAuthorizedRoleHeader of the Config.
+func WithEnableAuthorizedRoleHeader(enableAuthorizedRoleHeader bool) Option {
+	return func(c *Config) {
+		c.EnableAuthorizedRoleHeader = enableAuthorizedRoleHeader
+	}
+}
+
+// WithAuthorizedRoleHeader sets the AuthorizedRoleHeader of the Config.
+func WithAuthorizedRoleHeader(authorizedRoleHeader string) Option {
+	return func(c *Config) {
+		c.AuthorizedRoleHeader = authorizedRoleHeader
+	}
+}
+
+// WithEnableExplain sets the EnableExplain of the Config.
+func WithEnableExplain(enableExplain bool) Option {
+	return func(c *Config) {
+		c.EnableExplain = enableExplain
+	}
+}
+
+// WithMatchedPolicyKey sets the MatchedPolicyKey of the Config.
+func WithMatchedPolicyKey(matchedPolicyKey string) Option {
+	return func(c *Config) {
+		c.MatchedPolicyKey = matchedPolicyKey
+	}
+}
+
+// WithExplainFunc sets the ExplainFunc of the Config.
+func WithExplainFunc(explainFunc func(allowed bool, role string, rule []string, obj string, act string)) Option {
+	return func(c *Config) {
+		c.ExplainFunc = explainFunc
+	}
+}
+
+// WithEnforceTimeout sets the EnforceTimeout of the Config.
+func WithEnforceTimeout(enforceTimeout time.Duration) Option {
+	return func(c *Config) {
+		c.EnforceTimeout = enforceTimeout
+	}
+}
+
+// WithPolicyFile sets the PolicyFile of the Config.
+func WithPolicyFile(policyFile string) Option {
+	return func(c *Config) {
+		c.PolicyFile = policyFile
+	}
+}
+
+// WithReloadLock sets the ReloadLock of the Config.
+func WithReloadLock(reloadLock *sync.RWMutex) Option {
+	return func(c *Config) {
+		c.ReloadLock = reloadLock
+	}
+}
+
+// WithWatchInterval sets the WatchInterval of the Config.
+func WithWatchInterval(watchInterval time.Duration) Option {
+	return func(c *Config) {
+		c.WatchInterval = watchInterval
+	}
+}
+
+// WithWatchContext sets the WatchContext of the Config.
+func WithWatchContext(watchContext context.Context) Option {
+	return func(c *Config) {
+		c.WatchContext = watchContext
+	}
+}
+
+// WithMetricsCollector sets the MetricsCollector of the Config.
+func WithMetricsCollector(metricsCollector MetricsCollector) Option {
+	return func(c *Config) {
+		c.MetricsCollector = metricsCollector
+	}
+}
+
+// WithAuditLogger sets the AuditLogger of the Config.
+func WithAuditLogger(auditLogger AuditLogger) Option {
+	return func(c *Config) {
+		c.AuditLogger = auditLogger
+	}
+}
+
+// WithTraceIDKey sets the TraceIDKey of the Config.
+func WithTraceIDKey(traceIDKey string) Option {
+	return func(c *Config) {
+		c.TraceIDKey = traceIDKey
+	}
+}
+
+// WithCacheTTL sets the CacheTTL of the Config.
+func WithCacheTTL(cacheTTL time.Duration) Option {
+	return func(c *Config) {
+		c.CacheTTL = cacheTTL
+	}
+}
+
+// WithCacheSize sets the CacheSize of the Config.
+func WithCacheSize(cacheSize int) Option {
+	return func(c *Config) {
+		c.CacheSize = cacheSize
+	}
+}
+
+// WithPolicyGeneration sets the PolicyGeneration of the Config.
+func WithPolicyGeneration(policyGeneration *uint64) Option {
+	return func(c *Config) {
+		c.PolicyGeneration = policyGeneration
+	}
+}
+
+// WithUseBatchEnforce sets the UseBatchEnforce of the Config.
+func WithUseBatchEnforce(useBatchEnforce bool) Option {
+	return func(c *Config) {
+		c.UseBatchEnforce = useBatchEnforce
+	}
+}
+
+// WithOnDecision sets the OnDecision of the Config.
+func WithOnDecision(onDecision func(c echo.Context, allowed bool, roles []string, obj string, act string)) Option {
+	return func(c *Config) {
+		c.OnDecision = onDecision
+	}
+}
+
+// WithFailOpen sets the FailOpen of the Config.
+func WithFailOpen(failOpen bool) Option {
+	return func(c *Config) {
+		c.FailOpen = failOpen
+	}
+}
+
+// WithOnEnforceError sets the OnEnforceError of the Config.
+func WithOnEnforceError(onEnforceError func(c echo.Context, role string, obj string, act string, err error)) Option {
+	return func(c *Config) {
+		c.OnEnforceError = onEnforceError
+	}
+}
+
+// WithErrorHandler sets the ErrorHandler of the Config.
+func WithErrorHandler(errorHandler func(c echo.Context, roles []string, obj string, act string) error) Option {
+	return func(c *Config) {
+		c.ErrorHandler = errorHandler
+	}
+}
+
+// WithSuccessFunc sets the SuccessFunc of the Config.
+func WithSuccessFunc(successFunc func(string, string, string)) Option {
+	return func(c *Config) {
+		c.SuccessFunc = successFunc
+	}
+}
+
+// WithFailureFunc sets the FailureFunc of the Config.
+func WithFailureFunc(failureFunc func([]string, string, string)) Option {
+	return func(c *Config) {
+		c.FailureFunc = failureFunc
+	}
+}
+
+// WithOnAllow sets the OnAllow of the Config.
+func WithOnAllow(onAllow func(c echo.Context, matchedRole string, roles []string, obj string, act string)) Option {
+	return func(c *Config) {
+		c.OnAllow = onAllow
+	}
+}
+
+// WithOnDeny sets the OnDeny of the Config.
+func WithOnDeny(onDeny func(c echo.Context, roles []string, obj string, act string)) Option {
+	return func(c *Config) {
+		c.OnDeny = onDeny
+	}
+}
+
+// WithAfterAllow sets the AfterAllow of the Config.
+func WithAfterAllow(afterAllow func(c echo.Context, enforcer casbin.IEnforcer, role string, obj string, act string) error) Option {
+	return func(c *Config) {
+		c.AfterAllow = afterAllow
+	}
+}
+
+// WithFailOnAfterAllowError sets the FailOnAfterAllowError of the Config.
+func WithFailOnAfterAllowError(failOnAfterAllowError bool) Option {
+	return func(c *Config) {
+		c.FailOnAfterAllowError = failOnAfterAllowError
+	}
+}
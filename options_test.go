@@ -0,0 +1,79 @@
+package casbin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCasbinWith(t *testing.T) {
+	testCases := []struct {
+		name       string
+		opts       []Option
+		roles      string
+		endpoint   string
+		statusCode int
+	}{
+		{"enforcer", []Option{WithEnforcer(enforcer)}, "admin", "/admin", http.StatusForbidden},
+		{"roles header", []Option{WithEnforcer(enforcer), WithEnableRolesHeader(true)}, "admin", "/admin", http.StatusOK},
+		{
+			"roles header and object func",
+			[]Option{
+				WithEnforcer(enforcer),
+				WithEnableRolesHeader(true),
+				WithObjectFunc(func(c echo.Context) (string, error) { return "/admin", nil }),
+			},
+			"user", "/user", http.StatusForbidden,
+		},
+		{
+			"skipper",
+			[]Option{
+				WithEnforcer(enforcer),
+				WithEnableRolesHeader(true),
+				WithSkipper(func(c echo.Context) bool { return c.Path() == "/admin" }),
+			},
+			"any", "/admin", http.StatusOK,
+		},
+		{
+			"forbidden status code and message",
+			[]Option{
+				WithEnforcer(enforcer),
+				WithEnableRolesHeader(true),
+				WithForbiddenStatusCode(http.StatusNotFound),
+				WithForbiddenMessage("not found"),
+			},
+			"user", "/admin", http.StatusNotFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+
+			e.GET(tc.endpoint, func(c echo.Context) error {
+				return c.JSON(http.StatusOK, "ok")
+			})
+
+			e.Use(CasbinWith(tc.opts...))
+
+			req := httptest.NewRequest(http.MethodGet, tc.endpoint, nil)
+			req.Header.Add("X-Roles", tc.roles)
+			resp := httptest.NewRecorder()
+
+			e.ServeHTTP(resp, req)
+
+			assert.Equal(t, tc.statusCode, resp.Code)
+		})
+	}
+}
+
+func TestCasbinWith_DoesNotModifyDefaultConfig(t *testing.T) {
+	e := echo.New()
+	e.Use(CasbinWith(WithEnforcer(enforcer), WithRolesHeader("X-Other-Roles")))
+
+	assert.Nil(t, DefaultConfig.Enforcer)
+	assert.Equal(t, "X-Roles", DefaultConfig.RolesHeader)
+}
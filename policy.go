@@ -0,0 +1,104 @@
+package casbin
+
+import (
+	"net/http"
+
+	"github.com/casbin/casbin/v2"
+	"github.com/labstack/echo/v4"
+)
+
+// Policy is the JSON body read by the policy management handlers.
+type Policy struct {
+	Sub string `json:"sub"`
+	Obj string `json:"obj"`
+	Act string `json:"act"`
+}
+
+// AddPolicyHandler returns a handler that adds the policy in the
+// request body to the enforcer and saves the policies. It returns a 409
+// if the policy already exists. The handler can itself be protected by
+// the Casbin middleware. The policies are changed with UpdateSafely, so
+// the middleware's ReloadLock should be set to &ReloadLock unless the
+// enforcer is synchronized. The generation, if not nil, is bumped after
+// the policies change, to invalidate the cached decisions of the
+// middleware whose PolicyGeneration is set to it.
+func AddPolicyHandler(enforcer casbin.IEnforcer, generation *uint64) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		p, err := bindPolicy(c)
+		if err != nil {
+			return err
+		}
+
+		var added bool
+		err = UpdateSafely(enforcer, func() error {
+			var err error
+			added, err = enforcer.AddPolicy(p.Sub, p.Obj, p.Act)
+			if err != nil || !added {
+				return err
+			}
+			return enforcer.SavePolicy()
+		})
+		if added && generation != nil {
+			BumpGeneration(generation)
+		}
+		if err != nil {
+			return err
+		}
+
+		if !added {
+			return echo.NewHTTPError(http.StatusConflict, "Policy already exists")
+		}
+
+		return c.JSON(http.StatusCreated, p)
+	}
+}
+
+// RemovePolicyHandler returns a handler that removes the policy in the
+// request body from the enforcer and saves the policies. It returns a 404
+// if the policy doesn't exist. Like AddPolicyHandler, the policies are
+// changed with UpdateSafely and the generation is bumped if not nil.
+func RemovePolicyHandler(enforcer casbin.IEnforcer, generation *uint64) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		p, err := bindPolicy(c)
+		if err != nil {
+			return err
+		}
+
+		var removed bool
+		err = UpdateSafely(enforcer, func() error {
+			var err error
+			removed, err = enforcer.RemovePolicy(p.Sub, p.Obj, p.Act)
+			if err != nil || !removed {
+				return err
+			}
+			return enforcer.SavePolicy()
+		})
+		if removed && generation != nil {
+			BumpGeneration(generation)
+		}
+		if err != nil {
+			return err
+		}
+
+		if !removed {
+			return echo.NewHTTPError(http.StatusNotFound, "Policy not found")
+		}
+
+		return c.JSON(http.StatusOK, p)
+	}
+}
+
+// bindPolicy reads the policy in the request body, returning
+// a 400 if it's malformed or any of its fields is empty.
+func bindPolicy(c echo.Context) (*Policy, error) {
+	p := &Policy{}
+	if err := (&echo.DefaultBinder{}).BindBody(c, p); err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "Invalid policy")
+	}
+
+	if p.Sub == "" || p.Obj == "" || p.Act == "" {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "Invalid policy")
+	}
+
+	return p, nil
+}
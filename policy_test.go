@@ -0,0 +1,119 @@
+package casbin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/casbin/casbin/v2"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolicyHandlers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.csv")
+	writePolicy(t, path, "p, admin, /policies, (POST)|(DELETE)\n", time.Now())
+
+	pe, err := casbin.NewEnforcer("./fixtures/model.conf", path)
+	assert.NoError(t, err)
+
+	e := echo.New()
+
+	e.Use(CasbinWithConfig(Config{
+		Enforcer:          pe,
+		EnableRolesHeader: true,
+	}))
+
+	e.POST("/policies", AddPolicyHandler(pe, nil))
+	e.DELETE("/policies", RemovePolicyHandler(pe, nil))
+
+	steps := []struct {
+		name       string
+		method     string
+		roles      string
+		body       string
+		statusCode int
+		hasPolicy  bool
+	}{
+		{"add forbidden", http.MethodPost, "user", `{"sub":"user","obj":"/user","act":"GET"}`, http.StatusForbidden, false},
+		{"add", http.MethodPost, "admin", `{"sub":"user","obj":"/user","act":"GET"}`, http.StatusCreated, true},
+		{"add duplicate", http.MethodPost, "admin", `{"sub":"user","obj":"/user","act":"GET"}`, http.StatusConflict, true},
+		{"add malformed", http.MethodPost, "admin", `{"sub":`, http.StatusBadRequest, true},
+		{"add missing field", http.MethodPost, "admin", `{"sub":"user","obj":"/user"}`, http.StatusBadRequest, true},
+		{"remove", http.MethodDelete, "admin", `{"sub":"user","obj":"/user","act":"GET"}`, http.StatusOK, false},
+		{"remove missing", http.MethodDelete, "admin", `{"sub":"user","obj":"/user","act":"GET"}`, http.StatusNotFound, false},
+		{"remove malformed", http.MethodDelete, "admin", `[]`, http.StatusBadRequest, false},
+	}
+
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			req := httptest.NewRequest(step.method, "/policies", strings.NewReader(step.body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			req.Header.Add("X-Roles", step.roles)
+			resp := httptest.NewRecorder()
+
+			e.ServeHTTP(resp, req)
+
+			assert.Equal(t, step.statusCode, resp.Code)
+
+			assert.Equal(t, step.hasPolicy, pe.HasPolicy("user", "/user", "GET"))
+
+			b, err := os.ReadFile(path)
+			assert.NoError(t, err)
+			assert.Equal(t, step.hasPolicy, strings.Contains(string(b), "p, user, /user, GET"))
+		})
+	}
+}
+
+func TestPolicyHandlers_Cache(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.csv")
+	writePolicy(t, path, "p, admin, /policies, (POST)|(DELETE)\n", time.Now())
+
+	pe, err := casbin.NewEnforcer("./fixtures/model.conf", path)
+	assert.NoError(t, err)
+
+	e := echo.New()
+
+	var gen uint64
+	e.Use(CasbinWithConfig(Config{
+		Enforcer:          pe,
+		EnableRolesHeader: true,
+		CacheTTL:          time.Hour,
+		PolicyGeneration:  &gen,
+		ReloadLock:        &ReloadLock,
+	}))
+
+	e.GET("/user", func(c echo.Context) error {
+		return c.JSON(http.StatusOK, "ok")
+	})
+	e.POST("/policies", AddPolicyHandler(pe, &gen))
+	e.DELETE("/policies", RemovePolicyHandler(pe, &gen))
+
+	policy := func(method string) int {
+		req := httptest.NewRequest(method, "/policies", strings.NewReader(`{"sub":"user","obj":"/user","act":"GET"}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Add("X-Roles", "admin")
+		resp := httptest.NewRecorder()
+
+		e.ServeHTTP(resp, req)
+
+		return resp.Code
+	}
+
+	assert.Equal(t, http.StatusForbidden, serve(e, "user", "/user"))
+
+	assert.Equal(t, http.StatusCreated, policy(http.MethodPost))
+	assert.Equal(t, uint64(1), gen)
+	assert.Equal(t, http.StatusOK, serve(e, "user", "/user"))
+
+	assert.Equal(t, http.StatusOK, policy(http.MethodDelete))
+	assert.Equal(t, uint64(2), gen)
+	assert.Equal(t, http.StatusForbidden, serve(e, "user", "/user"))
+
+	assert.Equal(t, http.StatusNotFound, policy(http.MethodDelete))
+	assert.Equal(t, uint64(2), gen)
+}
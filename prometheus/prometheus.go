@@ -0,0 +1,57 @@
+// Package prometheus provides a Prometheus implementation
+// of the casbin.MetricsCollector.
+package prometheus
+
+import (
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Collector counts the authorization outcomes
+// per role, object and action. Every distinct object is a new
+// series, so the objects must be route templates, e.g. "/users/:id",
+// as with the default Echo#Path. Don't use it with UseRequestURI,
+// or an ObjectTemplate or ObjectFunc that returns the request's
+// values, which would create a series per request.
+type Collector struct {
+	allowed *prometheus.CounterVec
+	denied  *prometheus.CounterVec
+}
+
+// NewCollector returns a Collector with its counters
+// registered on the registerer. See Collector for the objects
+// it can be used with.
+func NewCollector(reg prometheus.Registerer) (*Collector, error) {
+	c := &Collector{
+		allowed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "casbin_allowed_total",
+			Help: "Number of authorized requests.",
+		}, []string{"role", "object", "action"}),
+		denied: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "casbin_denied_total",
+			Help: "Number of denied requests.",
+		}, []string{"roles", "object", "action"}),
+	}
+
+	if err := reg.Register(c.allowed); err != nil {
+		return nil, err
+	}
+
+	if err := reg.Register(c.denied); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// IncAllowed increments casbin_allowed_total for the authorized role.
+func (c *Collector) IncAllowed(role string, obj string, act string) {
+	c.allowed.WithLabelValues(role, obj, act).Inc()
+}
+
+// IncDenied increments casbin_denied_total for the denied roles,
+// joined with commas in a single label.
+func (c *Collector) IncDenied(roles []string, obj string, act string) {
+	c.denied.WithLabelValues(strings.Join(roles, ","), obj, act).Inc()
+}
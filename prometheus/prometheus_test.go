@@ -0,0 +1,36 @@
+package prometheus
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollector(t *testing.T) {
+	reg := prometheus.NewRegistry()
+
+	c, err := NewCollector(reg)
+	assert.NoError(t, err)
+
+	c.IncAllowed("user", "/user", "GET")
+	c.IncAllowed("user", "/user", "GET")
+	c.IncAllowed("admin", "/admin", "GET")
+	c.IncDenied([]string{"any", "user"}, "/admin", "GET")
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(c.allowed.WithLabelValues("user", "/user", "GET")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(c.allowed.WithLabelValues("admin", "/admin", "GET")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(c.denied.WithLabelValues("any,user", "/admin", "GET")))
+	assert.Equal(t, 3, testutil.CollectAndCount(c.allowed)+testutil.CollectAndCount(c.denied))
+}
+
+func TestNewCollector_Registered(t *testing.T) {
+	reg := prometheus.NewRegistry()
+
+	_, err := NewCollector(reg)
+	assert.NoError(t, err)
+
+	_, err = NewCollector(reg)
+	assert.Error(t, err)
+}
@@ -0,0 +1,49 @@
+package casbin
+
+import (
+	"sync"
+
+	"github.com/casbin/casbin/v2"
+)
+
+// ReloadLock is the lock ReloadSafely takes to reload the policies of
+// enforcers that aren't synchronized, e.g. a *casbin.Enforcer. Set
+// Config.ReloadLock to it for the middleware to take its read lock
+// while enforcing.
+var ReloadLock sync.RWMutex
+
+// ReloadSafely reloads the policies of the enforcer. Synchronized
+// enforcers, e.g. a *casbin.SyncedEnforcer, reload under their own lock,
+// others under the ReloadLock, which the middleware only respects if
+// Config.ReloadLock is set to it.
+func ReloadSafely(enforcer casbin.IEnforcer) error {
+	if isSynced(enforcer) {
+		return enforcer.LoadPolicy()
+	}
+
+	ReloadLock.Lock()
+	defer ReloadLock.Unlock()
+
+	return enforcer.LoadPolicy()
+}
+
+// UpdateSafely runs fn, which modifies the policies of the enforcer,
+// e.g. with AddPolicy. Synchronized enforcers already lock in their
+// methods, so fn runs as is, others under the ReloadLock, like ReloadSafely.
+func UpdateSafely(enforcer casbin.IEnforcer, fn func() error) error {
+	if isSynced(enforcer) {
+		return fn()
+	}
+
+	ReloadLock.Lock()
+	defer ReloadLock.Unlock()
+
+	return fn()
+}
+
+// isSynced reports whether the enforcer locks in its methods,
+// e.g. a *casbin.SyncedEnforcer.
+func isSynced(enforcer casbin.IEnforcer) bool {
+	_, ok := enforcer.(interface{ GetLock() *sync.RWMutex })
+	return ok
+}
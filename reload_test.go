@@ -0,0 +1,98 @@
+package casbin
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/casbin/casbin/v2"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReloadSafely(t *testing.T) {
+	plain, err := casbin.NewEnforcer("./fixtures/model.conf", "./fixtures/policy.csv")
+	assert.NoError(t, err)
+
+	synced, err := casbin.NewSyncedEnforcer("./fixtures/model.conf", "./fixtures/policy.csv")
+	assert.NoError(t, err)
+
+	testCases := []struct {
+		name     string
+		enforcer casbin.IEnforcer
+		lock     *sync.RWMutex
+	}{
+		{"enforcer", plain, &ReloadLock},
+		{"synced enforcer", synced, nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+
+			e.GET("/user", func(c echo.Context) error {
+				return c.JSON(http.StatusOK, "ok")
+			})
+
+			config := Config{
+				Enforcer:          tc.enforcer,
+				EnableRolesHeader: true,
+				Capabilities:      map[string][]string{"/admin": {"GET"}},
+				ReloadLock:        tc.lock,
+			}
+			e.Use(CasbinWithConfig(config))
+
+			var wg sync.WaitGroup
+			for i := 0; i < 4; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for j := 0; j < 25; j++ {
+						assert.Equal(t, http.StatusOK, serve(e, "user", "/user"))
+					}
+				}()
+			}
+
+			for i := 0; i < 25; i++ {
+				assert.NoError(t, ReloadSafely(tc.enforcer))
+			}
+
+			wg.Wait()
+		})
+	}
+}
+
+func TestUpdateSafely(t *testing.T) {
+	plain, err := casbin.NewEnforcer("./fixtures/model.conf", "./fixtures/policy.csv")
+	assert.NoError(t, err)
+
+	synced, err := casbin.NewSyncedEnforcer("./fixtures/model.conf", "./fixtures/policy.csv")
+	assert.NoError(t, err)
+
+	testCases := []struct {
+		name     string
+		enforcer casbin.IEnforcer
+		locked   bool
+	}{
+		{"enforcer", plain, true},
+		{"synced enforcer", synced, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := UpdateSafely(tc.enforcer, func() error {
+				assert.Equal(t, !tc.locked, ReloadLock.TryRLock())
+				if !tc.locked {
+					ReloadLock.RUnlock()
+				}
+				_, err := tc.enforcer.AddPolicy("guest", "/guest", "GET")
+				return err
+			})
+			assert.NoError(t, err)
+
+			ok, err := tc.enforcer.Enforce("guest", "/guest", "GET")
+			assert.NoError(t, err)
+			assert.True(t, ok)
+		})
+	}
+}
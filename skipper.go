@@ -0,0 +1,48 @@
+package casbin
+
+import (
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// SkipPaths returns a Skipper skipping the requests whose route path,
+// as returned by c.Path(), is exactly one of the paths. Use it as the
+// Config.Skipper. It replaces the default Skipper, call it from your
+// own Skipper to combine it with other logic. SkipOptions still applies.
+func SkipPaths(paths ...string) middleware.Skipper {
+	set := make(map[string]struct{}, len(paths))
+	for _, p := range paths {
+		set[p] = struct{}{}
+	}
+
+	return func(c echo.Context) bool {
+		_, ok := set[c.Path()]
+		return ok
+	}
+}
+
+// SkipPathPrefixes returns a Skipper like SkipPaths, but skipping the
+// requests whose route path starts with one of the prefixes followed
+// by a "/" or the end of the path, e.g. "/public" skips "/public"
+// and "/public/css" but not "/publications".
+func SkipPathPrefixes(prefixes ...string) middleware.Skipper {
+	trimmed := make([]string, len(prefixes))
+	for i, p := range prefixes {
+		trimmed[i] = strings.TrimSuffix(p, "/")
+	}
+
+	return func(c echo.Context) bool {
+		path := c.Path()
+		for _, p := range trimmed {
+			if !strings.HasPrefix(path, p) {
+				continue
+			}
+			if rest := path[len(p):]; rest == "" || rest[0] == '/' {
+				return true
+			}
+		}
+		return false
+	}
+}
@@ -0,0 +1,58 @@
+package casbin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSkipPaths(t *testing.T) {
+	testCases := []struct {
+		name     string
+		skipper  middleware.Skipper
+		endpoint string
+		skipped  bool
+	}{
+		{"exact", SkipPaths("/health", "/metrics", "/login"), "/health", true},
+		{"exact other", SkipPaths("/health", "/metrics", "/login"), "/login", true},
+		{"exact no match", SkipPaths("/health", "/metrics", "/login"), "/admin", false},
+		{"exact sub path", SkipPaths("/health"), "/health/live", false},
+		{"exact none", SkipPaths(), "/health", false},
+		{"prefix", SkipPathPrefixes("/public"), "/public", true},
+		{"prefix sub path", SkipPathPrefixes("/public"), "/public/css", true},
+		{"prefix trailing slash", SkipPathPrefixes("/public/"), "/public/css", true},
+		{"prefix partial segment", SkipPathPrefixes("/public"), "/publications", false},
+		{"prefix no match", SkipPathPrefixes("/public"), "/admin", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+
+			e.GET(tc.endpoint, func(c echo.Context) error {
+				return c.JSON(http.StatusOK, "ok")
+			})
+
+			config := Config{
+				Enforcer: enforcer,
+				Skipper:  tc.skipper,
+			}
+			e.Use(CasbinWithConfig(config))
+
+			req := httptest.NewRequest(http.MethodGet, tc.endpoint, nil)
+			resp := httptest.NewRecorder()
+
+			e.ServeHTTP(resp, req)
+
+			if tc.skipped {
+				assert.Equal(t, http.StatusOK, resp.Code)
+			} else {
+				assert.Equal(t, http.StatusForbidden, resp.Code)
+			}
+		})
+	}
+}
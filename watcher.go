@@ -0,0 +1,73 @@
+package casbin
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/casbin/casbin/v2"
+)
+
+// WatchPolicyFile polls the modification time of the policy file at path
+// every interval and reloads the policies of the enforcer when it changes.
+// The enforcer must be the same instance that was passed to the middleware
+// and should be a *casbin.SyncedEnforcer, as reloading the policies of a
+// *casbin.Enforcer while it's enforcing isn't safe unless Config.ReloadLock
+// is set to &ReloadLock, see ReloadSafely.
+// Reloading isn't retried until the file changes again if it fails.
+// Nothing is watched if interval isn't positive.
+// Call stop to stop watching, the policies won't be reloaded once it returns.
+func WatchPolicyFile(enforcer casbin.IEnforcer, path string, interval time.Duration) (stop func()) {
+	return watchPolicyFile(context.Background(), enforcer, path, interval, nil)
+}
+
+// watchPolicyFile is WatchPolicyFile with a context that stops it once
+// it's done, and a function that runs after the policies were reloaded successfully.
+func watchPolicyFile(ctx context.Context, enforcer casbin.IEnforcer, path string, interval time.Duration, onReload func()) func() {
+	if interval <= 0 {
+		return func() {}
+	}
+
+	var modTime time.Time
+	if fi, err := os.Stat(path); err == nil {
+		modTime = fi.ModTime()
+	}
+
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				fi, err := os.Stat(path)
+				if err != nil || fi.ModTime().Equal(modTime) {
+					continue
+				}
+				modTime = fi.ModTime()
+
+				if err := ReloadSafely(enforcer); err != nil {
+					continue
+				}
+
+				if onReload != nil {
+					onReload()
+				}
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+		<-stopped
+	}
+}
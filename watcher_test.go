@@ -0,0 +1,170 @@
+package casbin
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/casbin/casbin/v2"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func writePolicy(t *testing.T, path string, policy string, modTime time.Time) {
+	err := os.WriteFile(path, []byte(policy), 0o600)
+	assert.NoError(t, err)
+
+	err = os.Chtimes(path, modTime, modTime)
+	assert.NoError(t, err)
+}
+
+func serve(e *echo.Echo, roles string, endpoint string) int {
+	return serveMethod(e, http.MethodGet, roles, endpoint)
+}
+
+func serveMethod(e *echo.Echo, method string, roles string, endpoint string) int {
+	req := httptest.NewRequest(method, endpoint, nil)
+	req.Header.Add("X-Roles", roles)
+	resp := httptest.NewRecorder()
+
+	e.ServeHTTP(resp, req)
+
+	return resp.Code
+}
+
+func TestWatchPolicyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.csv")
+	writePolicy(t, path, "p, user, /user, GET\n", time.Now().Add(-time.Hour))
+
+	we, err := casbin.NewSyncedEnforcer("./fixtures/model.conf", path)
+	assert.NoError(t, err)
+
+	e := echo.New()
+
+	e.GET("/admin", func(c echo.Context) error {
+		return c.JSON(http.StatusOK, "ok")
+	})
+
+	config := Config{
+		Enforcer:          we,
+		EnableRolesHeader: true,
+	}
+	e.Use(CasbinWithConfig(config))
+
+	stop := WatchPolicyFile(we, path, 10*time.Millisecond)
+	defer stop()
+
+	assert.Equal(t, http.StatusForbidden, serve(e, "user", "/admin"))
+
+	writePolicy(t, path, "p, user, /admin, GET\n", time.Now())
+
+	assert.Eventually(t, func() bool {
+		return serve(e, "user", "/admin") == http.StatusOK
+	}, time.Second, 10*time.Millisecond)
+
+	stop()
+	stop()
+
+	writePolicy(t, path, "p, user, /user, GET\n", time.Now().Add(time.Hour))
+
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, http.StatusOK, serve(e, "user", "/admin"))
+}
+
+func TestJWTWithConfig_PolicyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.csv")
+	writePolicy(t, path, "p, user, /user, GET\n", time.Now().Add(-time.Hour))
+
+	we, err := casbin.NewSyncedEnforcer("./fixtures/model.conf", path)
+	assert.NoError(t, err)
+
+	e := echo.New()
+
+	e.GET("/admin", func(c echo.Context) error {
+		return c.JSON(http.StatusOK, "ok")
+	})
+	e.GET("/user", func(c echo.Context) error {
+		return c.JSON(http.StatusOK, "ok")
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	config := Config{
+		Enforcer:          we,
+		EnableRolesHeader: true,
+		CacheTTL:          time.Hour,
+		PolicyFile:        path,
+		WatchInterval:     10 * time.Millisecond,
+		WatchContext:      ctx,
+	}
+	e.Use(CasbinWithConfig(config))
+
+	assert.Equal(t, http.StatusForbidden, serve(e, "user", "/admin"))
+
+	writePolicy(t, path, "p, user, /admin, GET\n", time.Now())
+
+	assert.Eventually(t, func() bool {
+		return serve(e, "user", "/admin") == http.StatusOK
+	}, time.Second, 10*time.Millisecond)
+
+	cancel()
+	time.Sleep(50 * time.Millisecond)
+
+	writePolicy(t, path, "p, user, /user, GET\n", time.Now().Add(time.Hour))
+
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, http.StatusForbidden, serve(e, "user", "/user"))
+}
+
+func TestWatchPolicyFile_Interval(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.csv")
+	writePolicy(t, path, "p, user, /user, GET\n", time.Now().Add(-time.Hour))
+
+	we, err := casbin.NewEnforcer("./fixtures/model.conf", path)
+	assert.NoError(t, err)
+
+	for _, interval := range []time.Duration{0, -time.Second} {
+		assert.NotPanics(t, func() {
+			stop := WatchPolicyFile(we, path, interval)
+			stop()
+		})
+	}
+}
+
+func TestJWTWithConfig_PolicyFileEnforcer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.csv")
+	writePolicy(t, path, "p, user, /user, GET\n", time.Now().Add(-time.Hour))
+
+	we, err := casbin.NewEnforcer("./fixtures/model.conf", path)
+	assert.NoError(t, err)
+
+	e := echo.New()
+
+	e.GET("/admin", func(c echo.Context) error {
+		return c.JSON(http.StatusOK, "ok")
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	config := Config{
+		Enforcer:          we,
+		EnableRolesHeader: true,
+		PolicyFile:        path,
+		WatchInterval:     time.Millisecond,
+		WatchContext:      ctx,
+	}
+	e.Use(CasbinWithConfig(config))
+
+	writePolicy(t, path, "p, user, /admin, GET\n", time.Now())
+
+	// Run with -race: the reloads must not overlap the enforcement.
+	assert.Eventually(t, func() bool {
+		return serve(e, "user", "/admin") == http.StatusOK
+	}, time.Second, time.Millisecond)
+}